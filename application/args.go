@@ -0,0 +1,241 @@
+package application
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// Options of code commands and custom commands
+const (
+	// FlagModel overrides the model of the command
+	FlagModel = "model"
+	// FlagLang overrides the language guessed from the file extension
+	FlagLang = "lang"
+	// FlagOut writes the answer to the file instead of the standard output
+	FlagOut = "out"
+	// FlagFramework is the test framework used by testgen
+	FlagFramework = "framework"
+)
+
+// CommandFlag is an option of the command given as '--name=value', or '--name' for boolean options
+type CommandFlag struct {
+	Name string
+	// Value is the placeholder of the value shown in help, or empty for boolean options
+	Value string
+	Help  string
+}
+
+// usage returns the option as shown in help, e.g. --model=<model>
+func (f CommandFlag) usage() string {
+	if f.Value == "" {
+		return "--" + f.Name
+	}
+	return "--" + f.Name + "=<" + f.Value + ">"
+}
+
+// Args are the arguments of the command bound to the names in its argument spec
+type Args struct {
+	// Raw is the text after the command name
+	Raw    string
+	values map[string]string
+	flags  map[string]string
+}
+
+// Value returns the argument of the name, or empty string if it is not given
+func (a Args) Value(name string) string {
+	return a.values[name]
+}
+
+// Values returns the arguments by names, where the optional ones not given are empty
+func (a Args) Values() map[string]string {
+	values := make(map[string]string, len(a.values))
+	for name, value := range a.values {
+		values[name] = value
+	}
+	return values
+}
+
+// Flag returns the value of the option, or empty string if it is not given
+func (a Args) Flag(name string) string {
+	return a.flags[name]
+}
+
+// Has returns true if the option is given
+func (a Args) Has(name string) bool {
+	_, ok := a.flags[name]
+	return ok
+}
+
+// ArgsError is the error of the arguments which do not match the command
+// Handlers can return it without Usage, which is completed with the usage of the command
+type ArgsError struct {
+	Usage string
+	Err   error
+}
+
+func (e *ArgsError) Error() string {
+	return fmt.Sprintf("%v\nUsage: %s", e.Err, e.Usage)
+}
+
+func (e *ArgsError) Unwrap() error {
+	return e.Err
+}
+
+// SplitArgs splits the text into arguments separated by spaces
+// Arguments can be quoted with double or single quotes at their beginning, after '=' of options or right after another quoted part,
+// which are joined as in shells, e.g. 'it'"'"'s' is it's, and '\"' and '\\' are escaped in double quotes
+func SplitArgs(text string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	quote := rune(0)
+	escaped := false
+	// quotable is true where a quote starts a quoted part rather than being a literal character
+	quotable := true
+	for _, r := range text {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+			quotable = true
+			continue
+		case quote != 0:
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			quotable = true
+			continue
+		case (r == '"' || r == '\'') && quotable:
+			quote = r
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+		quotable = quote == 0 && r == '='
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ParseArgs binds the words to the arguments and the options
+// Options can be placed anywhere before '--', and the rest of the words are bound to the arguments in order
+func ParseArgs(args []CommandArg, flags []CommandFlag, words []string) (Args, error) {
+	parsed := Args{
+		Raw:    strings.Join(words, " "),
+		values: map[string]string{},
+		flags:  map[string]string{},
+	}
+
+	positional := []string{}
+	for i, word := range words {
+		if word == "--" {
+			positional = append(positional, words[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(word, "--") {
+			positional = append(positional, word)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		flag, ok := findFlag(flags, name)
+		switch {
+		case !ok:
+			return Args{}, fmt.Errorf("unknown option --%s%s", name, internal.DidYouMean("--"+name, flagNames(flags)))
+		case flag.Value == "" && hasValue:
+			return Args{}, fmt.Errorf("option --%s takes no value", name)
+		case flag.Value == "":
+			parsed.flags[name] = "true"
+		case value == "":
+			return Args{}, fmt.Errorf("option --%s requires a value, e.g. %s", name, flag.usage())
+		default:
+			parsed.flags[name] = value
+		}
+	}
+
+	for i, arg := range args {
+		switch {
+		case arg.Variadic && i < len(positional):
+			parsed.values[arg.Name] = strings.Join(positional[i:], " ")
+			return parsed, nil
+		case i < len(positional):
+			parsed.values[arg.Name] = positional[i]
+		case arg.Optional:
+			parsed.values[arg.Name] = ""
+		default:
+			return Args{}, fmt.Errorf("missing argument <%s>", arg.Name)
+		}
+	}
+	if len(positional) > len(args) {
+		extra := make([]string, 0, len(positional)-len(args))
+		for _, word := range positional[len(args):] {
+			extra = append(extra, quoteArg(word))
+		}
+		return Args{}, fmt.Errorf("too many arguments: %s", strings.Join(extra, " "))
+	}
+	return parsed, nil
+}
+
+// FormatArgSpec returns the argument spec of the arguments, e.g. "<file> [function]"
+func FormatArgSpec(args []CommandArg) string {
+	tokens := make([]string, 0, len(args))
+	for _, arg := range args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Optional {
+			tokens = append(tokens, "["+name+"]")
+		} else {
+			tokens = append(tokens, "<"+name+">")
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// findFlag returns the option of the name
+func findFlag(flags []CommandFlag, name string) (CommandFlag, bool) {
+	for _, flag := range flags {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return CommandFlag{}, false
+}
+
+// flagNames returns the names of the options with '--' prefix
+func flagNames(flags []CommandFlag) []string {
+	names := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		names = append(names, "--"+flag.Name)
+	}
+	return names
+}
+
+// quoteArg quotes the argument if it has spaces or is empty
+func quoteArg(arg string) string {
+	if arg == "" || strings.IndexFunc(arg, unicode.IsSpace) >= 0 {
+		return strconv.Quote(arg)
+	}
+	return arg
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", text: "", want: []string{}},
+		{name: "spaces", text: "  a \t b  ", want: []string{"a", "b"}},
+		{name: "double quotes", text: `"hello world" x`, want: []string{"hello world", "x"}},
+		{name: "single quotes", text: `'hello world'`, want: []string{"hello world"}},
+		{name: "empty quotes", text: `'' ""`, want: []string{"", ""}},
+		{name: "escapes in double quotes", text: `"say \"hi\" C:\\dir \n"`, want: []string{`say "hi" C:\dir \n`}},
+		{name: "no escapes in single quotes", text: `'a\"b'`, want: []string{`a\"b`}},
+		{name: "quote in a word", text: `it's don"t`, want: []string{`it's`, `don"t`}},
+		{name: "adjacent quoted parts", text: `'it''s'`, want: []string{"its"}},
+		{name: "quoted apostrophe", text: `'it'"'"'s'`, want: []string{"it's"}},
+		{name: "quoted option value", text: `--out="my file.go" main.go`, want: []string{"--out=my file.go", "main.go"}},
+		{name: "unterminated double quote", text: `"hello`, wantErr: true},
+		{name: "unterminated single quote", text: `a 'b c`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitArgs(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitArgs(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	flags := []CommandFlag{
+		{Name: FlagModel, Value: "model"},
+		{Name: "verbose"},
+	}
+	tests := []struct {
+		name       string
+		spec       string
+		words      []string
+		wantValues map[string]string
+		wantFlags  map[string]string
+		// wantErr is the error message, or no error is expected if empty
+		wantErr string
+	}{
+		{
+			name:       "required and optional",
+			spec:       "<file> [function]",
+			words:      []string{"main.go", "main"},
+			wantValues: map[string]string{"file": "main.go", "function": "main"},
+			wantFlags:  map[string]string{},
+		},
+		{
+			name:       "omitted optional",
+			spec:       "<file> [function]",
+			words:      []string{"main.go"},
+			wantValues: map[string]string{"file": "main.go", "function": ""},
+			wantFlags:  map[string]string{},
+		},
+		{
+			name:       "variadic",
+			spec:       "<language> <text...>",
+			words:      []string{"French", "Good", "morning"},
+			wantValues: map[string]string{"language": "French", "text": "Good morning"},
+			wantFlags:  map[string]string{},
+		},
+		{
+			name:       "options anywhere",
+			spec:       "<file>",
+			words:      []string{"--verbose", "main.go", "--model=gpt-4"},
+			wantValues: map[string]string{"file": "main.go"},
+			wantFlags:  map[string]string{FlagModel: "gpt-4", "verbose": "true"},
+		},
+		{
+			name:       "words after --",
+			spec:       "<text...>",
+			words:      []string{"--verbose", "--", "--model=gpt-4", "is", "text"},
+			wantValues: map[string]string{"text": "--model=gpt-4 is text"},
+			wantFlags:  map[string]string{"verbose": "true"},
+		},
+		{
+			name:    "missing argument",
+			spec:    "<file> [function]",
+			words:   []string{},
+			wantErr: "missing argument <file>",
+		},
+		{
+			name:    "too many arguments",
+			spec:    "<file>",
+			words:   []string{"main.go", "main", "my func"},
+			wantErr: `too many arguments: main "my func"`,
+		},
+		{
+			name:    "unknown option",
+			spec:    "<file>",
+			words:   []string{"--modle=gpt-4", "main.go"},
+			wantErr: `unknown option --modle (did you mean "--model"?)`,
+		},
+		{
+			name:    "missing option value",
+			spec:    "<file>",
+			words:   []string{"--model", "main.go"},
+			wantErr: "option --model requires a value, e.g. --model=<model>",
+		},
+		{
+			name:    "value of boolean option",
+			spec:    "<file>",
+			words:   []string{"--verbose=yes", "main.go"},
+			wantErr: "option --verbose takes no value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := ParseArgSpec(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseArgs(args, flags, tt.words)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ParseArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Values(), tt.wantValues) {
+				t.Errorf("values = %q, want %q", got.Values(), tt.wantValues)
+			}
+			if !reflect.DeepEqual(got.flags, tt.wantFlags) {
+				t.Errorf("flags = %q, want %q", got.flags, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestFormatArgSpec(t *testing.T) {
+	for _, spec := range []string{"", "<file> [function]", "<language> <text...>", "[text...]"} {
+		args, err := ParseArgSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FormatArgSpec(args); got != spec {
+			t.Errorf("FormatArgSpec(ParseArgSpec(%q)) = %q", spec, got)
+		}
+	}
+}
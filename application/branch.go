@@ -0,0 +1,94 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+const (
+	previewLength = 40
+)
+
+// ShowTree prints the conversation tree
+// Messages on the active conversation are marked with '*'
+func (s *chatService) ShowTree() {
+	if len(s.history.root.children) == 0 {
+		fmt.Println("No messages yet")
+		return
+	}
+	s.history.walk(s.history.root, func(n *historyNode, depth int) {
+		if n == s.history.root {
+			return
+		}
+		mark := " "
+		if s.history.isActive(n) {
+			mark = "*"
+		}
+		flags := ""
+		if n.Pinned {
+			flags += " (pinned)"
+		}
+		if n.Summary != "" {
+			flags += " (summarized up to here)"
+		}
+		if n.Truncated {
+			flags += " (truncated)"
+		}
+		fmt.Printf("%s %s[%d] %s: %s%s\n", mark, strings.Repeat("  ", depth-1), n.ID, n.Role, preview(n.Content), flags)
+	})
+}
+
+// ShowBranches prints the branches of the conversation
+// The current branch is marked with '*'
+func (s *chatService) ShowBranches() {
+	leaves := s.history.leaves()
+	if len(leaves) == 0 {
+		fmt.Println("No branches yet")
+		return
+	}
+	for i, leaf := range leaves {
+		mark := " "
+		if s.history.isActive(leaf) {
+			mark = "*"
+		}
+		fmt.Printf("%s %d) %s\n", mark, i+1, branchTitle(leaf))
+	}
+}
+
+// Checkout switches the active conversation to the branch of index n
+func (s *chatService) Checkout(n int) error {
+	leaves := s.history.leaves()
+	if n < 1 || n > len(leaves) {
+		return fmt.Errorf("branch %d not found", n)
+	}
+	s.history.current = leaves[n-1]
+	fmt.Printf("Switched to branch %d: %s\n", n, branchTitle(leaves[n-1]))
+	s.autoSaveSession()
+	return nil
+}
+
+// branchTitle returns the latest user message and its answer of the branch
+func branchTitle(leaf *historyNode) string {
+	for n := leaf; n != nil; n = n.parent {
+		if n.Role != internal.RoleUser {
+			continue
+		}
+		if n == leaf {
+			return preview(n.Content)
+		}
+		return fmt.Sprintf("%s => %s", preview(n.Content), preview(leaf.Content))
+	}
+	return preview(leaf.Content)
+}
+
+// preview returns the beginning of the content in a single line
+func preview(content string) string {
+	preview := strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(preview) > previewLength {
+		preview = string([]rune(preview)[:previewLength]) + "..."
+	}
+	return preview
+}
@@ -6,130 +6,305 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"text/template"
 
-	"github.com/sashabaranov/go-openai"
 	"github.com/sota0121/go-ai-chat/internal"
-	"golang.org/x/exp/slog"
 )
 
 type ChatService interface {
+	Send(ctx context.Context, text string) error
 	SendText(ctx context.Context, text string) error
 	SendTextStream(ctx context.Context, text string) error
+	Ask(ctx context.Context, text string, w io.Writer) error
+	PinLastTurn() error
+	ShowSummary()
+	SaveSession() error
+	ListSessions() error
+	Sessions() ([]SessionInfo, error)
+	LoadSession(id string) error
+	Retry(ctx context.Context) error
+	Undo() error
+	EditLastMessage(ctx context.Context, text string) error
+	EditMessage(ctx context.Context, id int, text string) error
+	LastUserMessage() (string, error)
+	UserMessage(id int) (string, error)
+	ShowAlternates() error
+	SelectAlternate(n int) error
+	ShowTree()
+	ShowBranches()
+	Checkout(n int) error
+	Reset()
+	SetSystemMessage(text string)
+	AppendSystemMessage(text string)
+	Set(key, value string) error
+	ShowSettings()
+	Reconfigure(cfg ChatConfig) error
 }
 
-func NewChatService(systemMessages, userMessages []string) ChatService {
-	systemMessageContents := make([]openai.ChatCompletionMessage, 0, len(systemMessages))
-	for _, msg := range systemMessages {
-		systemMessageContents = append(systemMessageContents, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: msg,
-		})
-	}
-
-	userMessageContents := make([]openai.ChatCompletionMessage, 0, len(userMessages))
-	for _, msg := range userMessages {
-		userMessageContents = append(userMessageContents, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: msg,
-		})
-	}
+// ChatConfig is the configuration of ChatService
+type ChatConfig struct {
+	Params         internal.ModelParams
+	SystemMessages []string
+	UserMessages   []string
+	// Summarize enables summarizing trimmed histories instead of just dropping them
+	Summarize bool
+	// Stream enables receiving answers in stream
+	Stream bool
+	// SummaryPrompt is the prompt template of summaries, or nil to use the built-in one
+	SummaryPrompt *template.Template
+}
 
+func NewChatService(provider internal.Provider, tokenizer internal.Tokenizer, store internal.SessionStore, cfg ChatConfig) ChatService {
 	return &chatService{
-		SystemMessages: systemMessageContents,
-		UserMessages:   userMessageContents,
+		provider:       provider,
+		tokenizer:      tokenizer,
+		store:          store,
+		params:         cfg.Params,
+		summarize:      cfg.Summarize,
+		summaryPrompt:  summaryPromptOrDefault(cfg.SummaryPrompt),
+		stream:         cfg.Stream,
+		SystemMessages: toMessages(internal.RoleSystem, cfg.SystemMessages),
+		UserMessages:   toMessages(internal.RoleUser, cfg.UserMessages),
+		history:        newHistoryTree(),
 	}
 }
 
 type chatService struct {
-	SystemMessages []openai.ChatCompletionMessage
-	UserMessages   []openai.ChatCompletionMessage
-	Histories      []openai.ChatCompletionMessage
+	provider       internal.Provider
+	tokenizer      internal.Tokenizer
+	store          internal.SessionStore
+	session        *internal.Session
+	params         internal.ModelParams
+	summarize      bool
+	summaryPrompt  *template.Template
+	stream         bool
+	SystemMessages []internal.Message
+	UserMessages   []internal.Message
+	history        *historyTree
 }
 
 var _ ChatService = (*chatService)(nil)
 
+// Send sends text in stream or not according to the setting
+func (s *chatService) Send(ctx context.Context, text string) error {
+	if s.stream {
+		return s.SendTextStream(ctx, text)
+	}
+	return s.SendText(ctx, text)
+}
+
 func (s *chatService) SendText(ctx context.Context, text string) error {
-	openaiClient := internal.GetOpenAIClientFromContext(ctx)
+	node := s.appendUserMessage(text)
+	if err := s.reply(ctx); err != nil {
+		s.rollback(node)
+		return err
+	}
+	s.autoSaveSession()
+	return nil
+}
+
+func (s *chatService) SendTextStream(ctx context.Context, text string) error {
+	node := s.appendUserMessage(text)
+	if err := s.replyStream(ctx); err != nil {
+		s.rollback(node)
+		return err
+	}
+	s.autoSaveSession()
+	return nil
+}
 
-	s.Histories = append(s.Histories, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
+// Ask sends text once with the system and user messages and writes the answer to w
+// The answer is written without any decoration and is not recorded to histories
+func (s *chatService) Ask(ctx context.Context, text string, w io.Writer) error {
+	messages := make([]internal.Message, 0, len(s.SystemMessages)+len(s.UserMessages)+1)
+	messages = append(messages, s.SystemMessages...)
+	messages = append(messages, s.UserMessages...)
+	messages = append(messages, internal.Message{
+		Role:    internal.RoleUser,
 		Content: text,
 	})
-
-	allMessages := append(s.SystemMessages, s.UserMessages...)
-	allMessages = append(allMessages, s.Histories...)
-
-	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT3Dot5Turbo,
-		Messages: allMessages,
+	req := internal.ChatRequest{
+		ModelParams: s.params,
+		Messages:    messages,
 	}
 
-	response, err := openaiClient.CreateChatCompletion(ctx, req)
+	if s.stream {
+		return writeStream(ctx, s.provider, req, w)
+	}
+	response, err := s.provider.CreateChatCompletion(ctx, req)
 	if err != nil {
-		slog.Error("Error creating chat completion", err)
 		return err
 	}
+	_, err = fmt.Fprintln(w, response.Message.Content)
+	return err
+}
+
+// reply sends histories and appends the reply to histories
+func (s *chatService) reply(ctx context.Context) error {
+	messages := s.prepareMessages(ctx)
+
+	req := internal.ChatRequest{
+		ModelParams: s.params,
+		Messages:    messages,
+	}
 
-	if len(response.Choices) == 0 {
-		slog.Error("Error creating chat completion", errors.New("no choices"))
-		return errors.New("no choices")
+	response, err := s.provider.CreateChatCompletion(ctx, req)
+	if isCanceled(ctx) {
+		fmt.Println("(canceled)")
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
 	}
 
-	asistantResponse := response.Choices[0].Message
-	s.Histories = append(s.Histories, asistantResponse)
+	asistantResponse := response.Message
+	s.history.add(asistantResponse)
 
 	fmt.Printf("AI> %v\n", asistantResponse.Content)
+	s.printUsage(messages, asistantResponse.Content)
 	return nil
 }
 
-func (s *chatService) SendTextStream(ctx context.Context, text string) error {
-	openaiClient := internal.GetOpenAIClientFromContext(ctx)
-
-	s.Histories = append(s.Histories, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
-		Content: text,
-	})
+// replyStream sends histories and appends the reply received in stream to histories
+func (s *chatService) replyStream(ctx context.Context) error {
+	messages := s.prepareMessages(ctx)
 
-	allMessages := append(s.SystemMessages, s.UserMessages...)
-	allMessages = append(allMessages, s.Histories...)
-
-	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT3Dot5Turbo,
-		Messages: allMessages,
-		Stream:   true,
+	req := internal.ChatRequest{
+		ModelParams: s.params,
+		Messages:    messages,
 	}
 
-	stream, err := openaiClient.CreateChatCompletionStream(ctx, req)
+	stream, err := s.provider.CreateChatCompletionStream(ctx, req)
+	if err == nil {
+		// The stream is closed even if the request is canceled right after it is created
+		defer stream.Close()
+	}
+	if isCanceled(ctx) {
+		fmt.Println("(canceled)")
+		return ctx.Err()
+	}
 	if err != nil {
-		slog.Error("Error creating chat completion stream", err)
 		return err
 	}
-	defer stream.Close()
 
 	responseTokens := []string{}
 	fmt.Printf("AI> ")
 	for {
-		response, err := stream.Recv()
+		token, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			fmt.Printf("\n\n")
-			asistantResponse := openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleAssistant,
+			fmt.Printf("\n")
+			asistantResponse := internal.Message{
+				Role:    internal.RoleAssistant,
 				Content: strings.Join(responseTokens, ""),
 			}
-			s.Histories = append(s.Histories, asistantResponse)
+			s.history.add(asistantResponse)
+			s.printUsage(messages, asistantResponse.Content)
 			return nil
 		}
+		if isCanceled(ctx) {
+			return s.truncateReply(messages, strings.Join(responseTokens, ""))
+		}
 		if err != nil {
-			slog.Error("Error receiving chat completion stream", err)
+			fmt.Printf("\n")
 			return err
 		}
 
-		if len(response.Choices) == 0 {
-			slog.Error("Error creating chat completion", errors.New("no choices"))
-			continue
-		}
+		responseTokens = append(responseTokens, token)
+		fmt.Printf("%v", token)
+	}
+}
+
+// truncateReply keeps the partial answer received before the request was canceled
+// Nothing is kept if no token has been received yet
+func (s *chatService) truncateReply(messages []internal.Message, content string) error {
+	if content == "" {
+		fmt.Println("(canceled)")
+		return context.Canceled
+	}
+	fmt.Printf("\n(canceled: the answer is truncated)\n")
+	node := s.history.add(internal.Message{
+		Role:    internal.RoleAssistant,
+		Content: content,
+	})
+	node.Truncated = true
+	s.printUsage(messages, content)
+	return nil
+}
+
+// respond sends histories and appends the reply in stream or not according to the setting
+func (s *chatService) respond(ctx context.Context) error {
+	if s.stream {
+		return s.replyStream(ctx)
+	}
+	return s.reply(ctx)
+}
+
+// appendUserMessage appends text to histories as a user message
+func (s *chatService) appendUserMessage(text string) *historyNode {
+	return s.history.add(internal.Message{
+		Role:    internal.RoleUser,
+		Content: text,
+	})
+}
+
+// rollback removes the user message whose answer failed
+// so that the message can be sent again without duplicating it
+func (s *chatService) rollback(node *historyNode) {
+	s.history.remove(node)
+	fmt.Println("(the message was removed from the history since it failed)")
+}
+
+// prepareMessages returns messages to be sent
+// Old histories are trimmed to fit in the context window of the model
+// If summarize is enabled, the trimmed histories are merged into the summary of the active conversation
+func (s *chatService) prepareMessages(ctx context.Context) []internal.Message {
+	histories, dropped := s.trimHistories(s.histories())
+	if len(dropped) == 0 {
+		return s.messages(histories)
+	}
+	if !s.summarize {
+		fmt.Printf("(%d old messages were trimmed to fit in the context window)\n", len(dropped))
+		return s.messages(histories)
+	}
+
+	if err := s.updateSummary(ctx, dropped); err != nil {
+		fmt.Printf("(%d old messages were trimmed without summary)\n", len(dropped))
+		return s.messages(histories)
+	}
+	fmt.Printf("(%d old messages were summarized to fit in the context window)\n", len(dropped))
 
-		responseTokens = append(responseTokens, response.Choices[0].Delta.Content)
-		fmt.Printf("%v", response.Choices[0].Delta.Content)
+	// The summary may have grown, so trim again to keep in the budget
+	histories, dropped = s.trimHistories(s.histories())
+	if len(dropped) > 0 {
+		fmt.Printf("(%d old messages were trimmed to fit in the context window)\n", len(dropped))
 	}
+	return s.messages(histories)
+}
+
+// messages returns messages to be sent with the histories
+// This consists of system messages, summary, user messages and histories
+func (s *chatService) messages(histories []*historyNode) []internal.Message {
+	messages := make([]internal.Message, 0, len(s.SystemMessages)+len(s.UserMessages)+len(histories)+1)
+	messages = append(messages, s.SystemMessages...)
+	if summary, ok := s.summaryMessage(); ok {
+		messages = append(messages, summary)
+	}
+	messages = append(messages, s.UserMessages...)
+	for _, history := range histories {
+		messages = append(messages, history.Message)
+	}
+	return messages
+}
+
+// isCanceled returns true if the request is canceled by the user
+func isCanceled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// printUsage prints the number of tokens used by the request
+func (s *chatService) printUsage(messages []internal.Message, reply string) {
+	promptTokens := s.tokenizer.CountMessageTokens(messages)
+	completionTokens := s.tokenizer.CountTokens(reply)
+	fmt.Printf("(tokens: prompt %d + completion %d = %d / %d)\n\n",
+		promptTokens, completionTokens, promptTokens+completionTokens, internal.ContextSize(s.params.Model))
 }
@@ -0,0 +1,449 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+// newTestProvider starts the fake server with the responses and returns the provider connected to it
+// Failed requests are retried up to maxAttempts without backoff, or not retried if maxAttempts is zero
+func newTestProvider(t *testing.T, maxAttempts int, responses ...fakeopenai.Response) (*fakeopenai.Server, internal.Provider) {
+	t.Helper()
+	srv := fakeopenai.NewServer(responses...)
+	t.Cleanup(srv.Close)
+
+	if maxAttempts == 0 {
+		maxAttempts = 1
+	}
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = srv.BaseURL()
+	config.HTTPClient = &http.Client{
+		Transport: internal.NewRetryTransport(nil, internal.RetryPolicy{
+			MaxAttempts:    maxAttempts,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		}),
+	}
+	return srv, internal.NewOpenAIProvider(openai.NewClientWithConfig(config))
+}
+
+// newTestChatService creates chatService which stores sessions in a temporary directory
+func newTestChatService(t *testing.T, provider internal.Provider, cfg ChatConfig) *chatService {
+	t.Helper()
+	return newTestChatServiceWithStore(t, provider, internal.NewFileSessionStore(t.TempDir()), cfg)
+}
+
+// newTestChatServiceWithStore creates chatService which stores sessions in the store
+func newTestChatServiceWithStore(t *testing.T, provider internal.Provider, store internal.SessionStore, cfg ChatConfig) *chatService {
+	t.Helper()
+	if cfg.Params.Model == "" {
+		cfg.Params.Model = internal.DefaultModel
+	}
+	tokenizer, err := internal.NewTokenizer(cfg.Params.Model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewChatService(provider, tokenizer, store, cfg).(*chatService)
+}
+
+// requestMessages returns the messages of the request received by the server
+func requestMessages(req openai.ChatCompletionRequest) []internal.Message {
+	messages := make([]internal.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, internal.Message{Role: msg.Role, Content: msg.Content})
+	}
+	return messages
+}
+
+// historyMessages returns the messages of the active conversation
+func historyMessages(s *chatService) []internal.Message {
+	messages := []internal.Message{}
+	for _, node := range s.history.path() {
+		messages = append(messages, node.Message)
+	}
+	return messages
+}
+
+// cancelingProvider cancels the request after receiving the number of tokens in stream
+// Combined with Release of the fake server, this cancels at an exact point without timing
+type cancelingProvider struct {
+	internal.Provider
+	cancel context.CancelFunc
+	after  int
+}
+
+func (p *cancelingProvider) CreateChatCompletionStream(ctx context.Context, req internal.ChatRequest) (internal.TokenStream, error) {
+	stream, err := p.Provider.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &cancelingTokenStream{TokenStream: stream, cancel: p.cancel, left: p.after}, nil
+}
+
+type cancelingTokenStream struct {
+	internal.TokenStream
+	cancel context.CancelFunc
+	left   int
+}
+
+// Recv cancels the request when it is called for the token after the number of tokens
+func (s *cancelingTokenStream) Recv() (string, error) {
+	if s.left == 0 {
+		s.cancel()
+	}
+	s.left--
+	return s.TokenStream.Recv()
+}
+
+func user(content string) internal.Message {
+	return internal.Message{Role: internal.RoleUser, Content: content}
+}
+
+func assistant(content string) internal.Message {
+	return internal.Message{Role: internal.RoleAssistant, Content: content}
+}
+
+func system(content string) internal.Message {
+	return internal.Message{Role: internal.RoleSystem, Content: content}
+}
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+func TestChatService_SendText(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         ChatConfig
+		previous    []internal.Message
+		text        string
+		maxAttempts int
+		timeouts    internal.Timeouts
+		responses   []fakeopenai.Response
+		// wantRequests is the number of requests received by the server
+		wantRequests int
+		// wantMessages are the messages of the last request
+		wantMessages []internal.Message
+		wantHistory  []internal.Message
+		wantErr      bool
+	}{
+		{
+			name:         "single turn",
+			text:         "Hello",
+			responses:    []fakeopenai.Response{{Content: "Hi!"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+		{
+			name: "system and user messages",
+			cfg: ChatConfig{
+				SystemMessages: []string{"You are a bot"},
+				UserMessages:   []string{"Answer shortly"},
+			},
+			text:         "Hello",
+			responses:    []fakeopenai.Response{{Content: "Hi!"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{system("You are a bot"), user("Answer shortly"), user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+		{
+			name:         "multi turn",
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			responses:    []fakeopenai.Response{{Content: "Fine"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+		},
+		{
+			name:         "model params",
+			cfg:          ChatConfig{Params: internal.ModelParams{Model: "gpt-4", Temperature: float32Ptr(0.5), MaxTokens: 100}},
+			text:         "Hello",
+			responses:    []fakeopenai.Response{{Content: "Hi!"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+		{
+			name:         "old turns are trimmed",
+			cfg:          ChatConfig{Params: internal.ModelParams{MaxTokens: internal.ContextSize(internal.DefaultModel) - 16}},
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			responses:    []fakeopenai.Response{{Content: "Fine"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+		},
+		{
+			name: "old turns are summarized",
+			cfg: ChatConfig{
+				Params:    internal.ModelParams{MaxTokens: internal.ContextSize(internal.DefaultModel) - 16},
+				Summarize: true,
+			},
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			responses:    []fakeopenai.Response{{Content: "Greeted"}, {Content: "Fine"}},
+			wantRequests: 2,
+			wantMessages: []internal.Message{system(summarySystemMessageHeader + "\nGreeted"), user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+		},
+		{
+			name:         "server error rolls back the message",
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			responses:    []fakeopenai.Response{{Content: "internal error", StatusCode: http.StatusInternalServerError}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+			wantErr:      true,
+		},
+		{
+			name:        "rate limit is retried",
+			text:        "Hello",
+			maxAttempts: 2,
+			responses: []fakeopenai.Response{
+				{Content: "rate limited", StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"0"}}},
+				{Content: "Hi!"},
+			},
+			wantRequests: 2,
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+		{
+			name:         "request timeout",
+			text:         "Hello",
+			timeouts:     internal.Timeouts{Request: 50 * time.Millisecond},
+			responses:    []fakeopenai.Response{{Content: "Hi!", Release: make(chan struct{})}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{},
+			wantErr:      true,
+		},
+		{
+			name:         "first token timeout is not applied",
+			text:         "Hello",
+			timeouts:     internal.Timeouts{FirstToken: 10 * time.Millisecond},
+			responses:    []fakeopenai.Response{{Content: "Hi!", Delay: 50 * time.Millisecond}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, tt.maxAttempts, tt.responses...)
+			s := newTestChatService(t, internal.NewTimeoutProvider(provider, tt.timeouts), tt.cfg)
+			for _, msg := range tt.previous {
+				s.history.add(msg)
+			}
+
+			err := s.SendText(context.Background(), tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			last := requests[len(requests)-1]
+			if last.Stream {
+				t.Errorf("request is in stream")
+			}
+			params := s.params
+			if last.Model != params.Model {
+				t.Errorf("model = %q, want %q", last.Model, params.Model)
+			}
+			if params.Temperature != nil && last.Temperature != *params.Temperature {
+				t.Errorf("temperature = %v, want %v", last.Temperature, *params.Temperature)
+			}
+			if last.MaxTokens != params.MaxTokens {
+				t.Errorf("max tokens = %d, want %d", last.MaxTokens, params.MaxTokens)
+			}
+			if got := requestMessages(last); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("messages = %v, want %v", got, tt.wantMessages)
+			}
+			if got := historyMessages(s); !reflect.DeepEqual(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+		})
+	}
+}
+
+func TestChatService_SendTextStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []internal.Message
+		text     string
+		timeouts internal.Timeouts
+		response fakeopenai.Response
+		// cancel cancels the request after receiving cancelAfter tokens
+		// The server sends no more tokens until the request is canceled
+		cancel        bool
+		cancelAfter   int
+		wantMessages  []internal.Message
+		wantHistory   []internal.Message
+		wantTruncated bool
+		wantErr       error
+	}{
+		{
+			name:         "tokens are joined",
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			response:     fakeopenai.Response{Tokens: []string{"I'm", " fine", "."}},
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("I'm fine.")},
+		},
+		{
+			name:          "canceled answer is truncated",
+			text:          "Hello",
+			response:      fakeopenai.Response{Tokens: []string{"Hi", " there", "!"}},
+			cancel:        true,
+			cancelAfter:   1,
+			wantMessages:  []internal.Message{user("Hello")},
+			wantHistory:   []internal.Message{user("Hello"), assistant("Hi")},
+			wantTruncated: true,
+		},
+		{
+			name:         "canceled before the first token",
+			previous:     []internal.Message{user("Hello"), assistant("Hi!")},
+			text:         "How are you?",
+			response:     fakeopenai.Response{Tokens: []string{"Fine"}},
+			cancel:       true,
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+			wantErr:      context.Canceled,
+		},
+		{
+			name:         "first token timeout",
+			text:         "Hello",
+			timeouts:     internal.Timeouts{FirstToken: 50 * time.Millisecond},
+			response:     fakeopenai.Response{Tokens: []string{"Hi!"}, Release: make(chan struct{})},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{},
+			wantErr:      internal.ErrFirstTokenTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.cancel {
+				release := make(chan struct{}, tt.cancelAfter)
+				for i := 0; i < tt.cancelAfter; i++ {
+					release <- struct{}{}
+				}
+				tt.response.Release = release
+			}
+			srv, provider := newTestProvider(t, 0, tt.response)
+			if tt.cancel {
+				provider = &cancelingProvider{Provider: provider, cancel: cancel, after: tt.cancelAfter}
+			}
+			s := newTestChatService(t, internal.NewTimeoutProvider(provider, tt.timeouts), ChatConfig{})
+			for _, msg := range tt.previous {
+				s.history.add(msg)
+			}
+
+			err := s.SendTextStream(ctx, tt.text)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SendTextStream() error = %v, want %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("requests = %d, want 1", len(requests))
+			}
+			if !requests[0].Stream {
+				t.Errorf("request is not in stream")
+			}
+			if got := requestMessages(requests[0]); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("messages = %v, want %v", got, tt.wantMessages)
+			}
+			if got := historyMessages(s); !reflect.DeepEqual(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+			if got := s.history.current.Truncated; got != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", got, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestChatService_Ask(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          ChatConfig
+		text         string
+		response     fakeopenai.Response
+		wantStream   bool
+		wantMessages []internal.Message
+		wantOutput   string
+		wantErr      bool
+	}{
+		{
+			name:         "without stream",
+			cfg:          ChatConfig{SystemMessages: []string{"You are a bot"}},
+			text:         "Hello",
+			response:     fakeopenai.Response{Content: "Hi!"},
+			wantMessages: []internal.Message{system("You are a bot"), user("Hello")},
+			wantOutput:   "Hi!\n",
+		},
+		{
+			name:         "in stream",
+			cfg:          ChatConfig{UserMessages: []string{"Answer shortly"}, Stream: true},
+			text:         "Hello",
+			response:     fakeopenai.Response{Tokens: []string{"Hi", "!"}},
+			wantStream:   true,
+			wantMessages: []internal.Message{user("Answer shortly"), user("Hello")},
+			wantOutput:   "Hi!\n",
+		},
+		{
+			name:         "server error",
+			text:         "Hello",
+			response:     fakeopenai.Response{Content: "internal error", StatusCode: http.StatusInternalServerError},
+			wantMessages: []internal.Message{user("Hello")},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, 0, tt.response)
+			s := newTestChatService(t, provider, tt.cfg)
+
+			var out bytes.Buffer
+			err := s.Ask(context.Background(), tt.text, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Ask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("requests = %d, want 1", len(requests))
+			}
+			if requests[0].Stream != tt.wantStream {
+				t.Errorf("stream = %v, want %v", requests[0].Stream, tt.wantStream)
+			}
+			if got := requestMessages(requests[0]); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("messages = %v, want %v", got, tt.wantMessages)
+			}
+			if got := out.String(); got != tt.wantOutput {
+				t.Errorf("output = %q, want %q", got, tt.wantOutput)
+			}
+			// The answer is not recorded
+			if got := historyMessages(s); len(got) != 0 {
+				t.Errorf("history = %v, want empty", got)
+			}
+		})
+	}
+}
@@ -1,140 +1,241 @@
 package application
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slices"
 )
 
 const (
 	Version = "0.0.1"
 )
 
+var (
+	// ErrQuit is returned by the handler of the command to quit the chat
+	ErrQuit = errors.New("quit")
+	// ErrUnknownCommand is returned when no command is registered with the name
+	ErrUnknownCommand = errors.New("unknown command")
+)
+
 type CommandService interface {
-	ParseCommand(command string) CommandType
-	ShowHelp()
+	Register(command Command) error
+	Unregister(name string)
+	Execute(ctx context.Context, text string) error
+	ShowHelp(name string) error
 	ShowVersion()
+	Complete(line string) []string
+}
+
+// Command is a command of the chat, which is input as ':<name> <args>...'
+type Command struct {
+	Name    string
+	Aliases []string
+	// Args is the argument spec, e.g. "<file> [function]", which is shown in help and used for completion
+	Args string
+	// Help is the description shown in the list of commands
+	Help string
+	// Flags are the options given as '--name=value'
+	Flags []CommandFlag
+	// RawArgs passes the text after the command name as is in Args.Raw without parsing
+	RawArgs bool
+	// Usages are the forms of the command shown in ':help <command>'
+	Usages []CommandUsage
+	// Complete returns candidates for the argument being typed after args
+	// If nil, the arguments named in Args are completed
+	Complete func(args []string, word string) []string
+	// Handler executes the command with the arguments validated against Args and Flags
+	Handler func(ctx context.Context, args Args) error
+}
+
+// CommandUsage is a form of the command and its description
+type CommandUsage struct {
+	Args        string
+	Description string
 }
 
 func NewCommandService() CommandService {
-	return &commandService{
-		commandDefinitions: []commandDefinition{
-			{
-				commandType: TestGen,
-				name:        "testgen",
-				options: []commandOption{
-					{
-						name:        "<file>",
-						description: "generate test for <file>",
-					},
-					{
-						name:        "<file> <function>",
-						description: "generate test for <function> in <file>",
-					},
-				},
-			},
-			{
-				commandType: FindBugs,
-				name:        "findbugs",
-				options: []commandOption{
-					{
-						name:        "<file>",
-						description: "find bugs in <file>",
-					},
-					{
-						name:        "<file> <function>",
-						description: "find bugs in <function> in <file>",
-					},
-				},
-			},
-			{
-				commandType: ShowHelp,
-				name:        "help",
-				options: []commandOption{
-					{
-						name:        "",
-						description: "show help",
-					},
-				},
-			},
-			{
-				commandType: ShowVersion,
-				name:        "version",
-				options: []commandOption{
-					{
-						name:        "",
-						description: "show version",
-					},
-				},
-			},
-		},
-	}
+	return &commandService{}
+}
+
+// registeredCommand is the command with the parsed argument spec
+type registeredCommand struct {
+	Command
+	args []CommandArg
 }
 
 type commandService struct {
-	commandDefinitions []commandDefinition
+	// commands are in order of registration, which is the order of help
+	commands []registeredCommand
 }
 
 var _ CommandService = (*commandService)(nil)
 
-// ParseCommand parses command
-// This method expects command starts with ':'
-// If command is not found, return ShowHelp
-func (c *commandService) ParseCommand(command string) CommandType {
-	tokens := strings.Split(command, " ")
-	cmdName := tokens[0][1:]
-	switch cmdName {
-	case "help":
-		return ShowHelp
-	case "version":
-		return ShowVersion
-	case "quit":
-		return Quit
-	case "testgen":
-		return TestGen
-	case "findbugs":
-		return FindBugs
-	default:
-		return ShowHelp
-	}
-}
-
-type CommandType int
+// Register registers the command
+// The name and the aliases must not be used by the other commands
+func (c *commandService) Register(command Command) error {
+	if command.Name == "" || command.Handler == nil {
+		return errors.New("command requires name and handler")
+	}
+	for _, name := range append([]string{command.Name}, command.Aliases...) {
+		if _, ok := c.lookup(name); ok {
+			return fmt.Errorf("command :%s is already registered", name)
+		}
+	}
+	args, err := ParseArgSpec(command.Args)
+	if err != nil {
+		return fmt.Errorf("command :%s: %w", command.Name, err)
+	}
+	c.commands = append(c.commands, registeredCommand{Command: command, args: args})
+	return nil
+}
 
-const (
-	TestGen CommandType = iota
-	FindBugs
-	ShowHelp
-	ShowVersion
-	Quit
-)
+// Unregister removes the command of the name
+func (c *commandService) Unregister(name string) {
+	for i, command := range c.commands {
+		if command.Name == name {
+			c.commands = append(c.commands[:i], c.commands[i+1:]...)
+			return
+		}
+	}
+}
+
+// Execute parses the arguments in the text and executes the command with its handler
+// This expects text to start with ':'
+func (c *commandService) Execute(ctx context.Context, text string) error {
+	name, rest := splitCommand(text)
+	command, ok := c.lookup(name)
+	if !ok {
+		return c.unknownCommand(name)
+	}
+	if command.RawArgs {
+		return command.handle(ctx, Args{Raw: strings.TrimSpace(rest)})
+	}
 
-func (c CommandType) String() string {
-	return [...]string{"testgen", "findbugs", "help", "version", "quit"}[c]
+	words, err := SplitArgs(rest)
+	if err != nil {
+		return &ArgsError{Usage: command.usage(), Err: err}
+	}
+	args, err := ParseArgs(command.args, command.Flags, words)
+	if err != nil {
+		return &ArgsError{Usage: command.usage(), Err: err}
+	}
+	return command.handle(ctx, args)
+}
+
+// handle executes the handler, completing the usage of the errors of the arguments
+func (c registeredCommand) handle(ctx context.Context, args Args) error {
+	err := c.Handler(ctx, args)
+	var argsErr *ArgsError
+	if errors.As(err, &argsErr) && argsErr.Usage == "" {
+		argsErr.Usage = c.usage()
+	}
+	return err
 }
 
-type commandDefinition struct {
-	commandType CommandType
-	name        string
-	options     []commandOption
+// lookup returns the command whose name or alias is name
+func (c *commandService) lookup(name string) (registeredCommand, bool) {
+	for _, command := range c.commands {
+		if command.Name == name || slices.Contains(command.Aliases, name) {
+			return command, true
+		}
+	}
+	return registeredCommand{}, false
 }
 
-type commandOption struct {
-	name        string
-	description string
+// unknownCommand returns the error suggesting the command similar to name
+func (c *commandService) unknownCommand(name string) error {
+	return fmt.Errorf("%w :%s%s", ErrUnknownCommand, name, internal.DidYouMean(":"+name, c.commandNames()))
 }
 
-func (c commandDefinition) ShowHelp() {
-	for _, option := range c.options {
-		fmt.Printf("%s %s: %s\n", c.name, option.name, option.description)
+// ShowHelp shows the list of commands, or the usage of the command if name is not empty
+func (c *commandService) ShowHelp(name string) error {
+	if name == "" {
+		fmt.Println("Commands:")
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, command := range c.commands {
+			fmt.Fprintf(tw, "  %s\t%s\n", command.synopsis(), command.Help)
+		}
+		tw.Flush()
+		fmt.Println("Type ':help <command>' for details")
+		return nil
+	}
+
+	name = strings.TrimPrefix(name, ":")
+	command, ok := c.lookup(name)
+	if !ok {
+		return c.unknownCommand(name)
+	}
+	fmt.Println(command.synopsis())
+	if command.Help != "" {
+		fmt.Printf("  %s\n", command.Help)
+	}
+	if len(command.Usages) > 0 {
+		fmt.Println("Usage:")
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, usage := range command.Usages {
+			fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimSpace(":"+command.Name+" "+usage.Args), usage.Description)
+		}
+		tw.Flush()
 	}
+	if len(command.Flags) > 0 {
+		fmt.Println("Options:")
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, flag := range command.Flags {
+			fmt.Fprintf(tw, "  %s\t%s\n", flag.usage(), flag.Help)
+		}
+		tw.Flush()
+	}
+	if len(command.Aliases) > 0 {
+		aliases := make([]string, 0, len(command.Aliases))
+		for _, alias := range command.Aliases {
+			aliases = append(aliases, ":"+alias)
+		}
+		fmt.Printf("Aliases: %s\n", strings.Join(aliases, ", "))
+	}
+	return nil
 }
 
-func (c *commandService) ShowHelp() {
-	for _, commandDefinition := range c.commandDefinitions {
-		commandDefinition.ShowHelp()
+// synopsis returns the name and the argument spec of the command
+func (c registeredCommand) synopsis() string {
+	return strings.TrimSpace(":" + c.Name + " " + c.Args)
+}
+
+// usage returns the synopsis with the options shown in errors of the arguments
+func (c registeredCommand) usage() string {
+	if len(c.Flags) == 0 {
+		return c.synopsis()
 	}
+	return c.synopsis() + " [options]"
 }
 
 func (c *commandService) ShowVersion() {
 	fmt.Println("version: ", Version)
 }
+
+// splitCommand splits the text into the command name without ':' and the rest including the leading space
+func splitCommand(text string) (string, string) {
+	text = strings.TrimPrefix(text, ":")
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], text[i:]
+}
+
+// commandNames returns the names of the commands with ':' prefix
+func (c *commandService) commandNames() []string {
+	names := make([]string, 0, len(c.commands))
+	for _, command := range c.commands {
+		names = append(names, ":"+command.Name)
+	}
+	sort.Strings(names)
+	return names
+}
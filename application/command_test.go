@@ -0,0 +1,122 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommandService_Register(t *testing.T) {
+	tests := []struct {
+		name    string
+		command Command
+		wantErr bool
+	}{
+		{
+			name:    "new command",
+			command: Command{Name: "summary"},
+		},
+		{
+			name:    "duplicate name",
+			command: Command{Name: "help"},
+			wantErr: true,
+		},
+		{
+			name:    "alias used by the other command",
+			command: Command{Name: "exit", Aliases: []string{"h"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid argument spec",
+			command: Command{Name: "load", Args: "[id] <file>"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestCommandService(t, Command{Name: "help", Aliases: []string{"h"}})
+			tt.command.Handler = func(ctx context.Context, args Args) error {
+				return nil
+			}
+			if err := s.Register(tt.command); (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandService_Execute(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// wantID is the argument passed to the handler
+		wantID  string
+		wantErr bool
+		// wantMessage is contained in the error message
+		wantMessage string
+	}{
+		{
+			name:   "name",
+			text:   ":load latest",
+			wantID: "latest",
+		},
+		{
+			name:   "alias",
+			text:   ":resume  latest",
+			wantID: "latest",
+		},
+		{
+			name:   "quoted argument",
+			text:   `:load "my session"`,
+			wantID: "my session",
+		},
+		{
+			name:   "omitted optional argument",
+			text:   ":load",
+			wantID: "",
+		},
+		{
+			name:        "too many arguments",
+			text:        ":load a b",
+			wantErr:     true,
+			wantMessage: "too many arguments: b\nUsage: :load [id]",
+		},
+		{
+			name:        "unknown command",
+			text:        ":lod latest",
+			wantErr:     true,
+			wantMessage: `unknown command :lod (did you mean ":load"?)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := "(not called)"
+			s := newTestCommandService(t, Command{
+				Name:    "load",
+				Aliases: []string{"resume"},
+				Args:    "[id]",
+				Handler: func(ctx context.Context, args Args) error {
+					got = args.Value("id")
+					return nil
+				},
+			})
+
+			err := s.Execute(context.Background(), tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				if got != tt.wantID {
+					t.Errorf("id = %q, want %q", got, tt.wantID)
+				}
+				return
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("Execute() error = %q, want %q in the message", err, tt.wantMessage)
+			}
+			if got != "(not called)" {
+				t.Errorf("handler is called with %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package application
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Complete returns candidates for the last word of the line
+// Command names are completed at the beginning of the line,
+// and the options and the arguments are completed by the command, e.g. file paths and function names
+func (c *commandService) Complete(line string) []string {
+	if !strings.HasPrefix(line, ":") {
+		return nil
+	}
+
+	words := strings.Fields(line)
+	if strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	// Complete command name
+	if len(words) == 1 {
+		return filterPrefix(c.commandNames(), word)
+	}
+
+	command, ok := c.lookup(strings.TrimPrefix(words[0], ":"))
+	if !ok {
+		return nil
+	}
+	// Options are completed by names and skipped for the positions of the arguments
+	if strings.HasPrefix(word, "--") {
+		return completeFlags(command.Flags, word)
+	}
+	args := []string{}
+	for _, arg := range words[1 : len(words)-1] {
+		if !strings.HasPrefix(arg, "--") {
+			args = append(args, arg)
+		}
+	}
+	if command.Complete != nil {
+		return command.Complete(args, word)
+	}
+	return CompleteArgs(command.args, args, word)
+}
+
+// CompleteArgs returns candidates for the argument following the values
+// The file path is completed for 'file' argument and the function name in the file for 'function' argument
+func CompleteArgs(args []CommandArg, values []string, word string) []string {
+	if len(values) >= len(args) {
+		return nil
+	}
+	switch args[len(values)].Name {
+	case argFile:
+		// Declarations are completed after '#' and ','
+		if fileName, names, ok := strings.Cut(word, "#"); ok {
+			prefix := word[:len(fileName)+1+strings.LastIndex(names, ",")+1]
+			declNames, err := listDeclarations(fileName)
+			if err != nil {
+				return nil
+			}
+			candidates := []string{}
+			for _, name := range filterPrefix(declNames, word[len(prefix):]) {
+				candidates = append(candidates, prefix+name)
+			}
+			return candidates
+		}
+		return completeFilePath(word)
+	case argFunction:
+		for i, arg := range args[:len(values)] {
+			if arg.Name != argFile {
+				continue
+			}
+			funcNames, err := listDeclarations(values[i])
+			if err != nil {
+				return nil
+			}
+			return filterPrefix(funcNames, word)
+		}
+	}
+	return nil
+}
+
+// completeFlags returns the options which start with prefix
+// Options taking a value end with '=' to continue to the value
+func completeFlags(flags []CommandFlag, prefix string) []string {
+	candidates := []string{}
+	for _, flag := range flags {
+		candidate := "--" + flag.Name
+		if flag.Value != "" {
+			candidate += "="
+		}
+		if strings.HasPrefix(candidate, prefix) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// completeFilePath returns file paths which start with prefix
+// Directories end with the path separator to continue completion
+func completeFilePath(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := dir + name
+		if entry.IsDir() {
+			path += string(filepath.Separator)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// filterPrefix returns candidates which start with prefix
+func filterPrefix(candidates []string, prefix string) []string {
+	filtered := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
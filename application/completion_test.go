@@ -0,0 +1,97 @@
+package application
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// newTestCommandService creates commandService with the commands which do nothing
+func newTestCommandService(t *testing.T, commands ...Command) *commandService {
+	t.Helper()
+	s := NewCommandService().(*commandService)
+	for _, command := range commands {
+		if command.Handler == nil {
+			command.Handler = func(ctx context.Context, args Args) error {
+				return nil
+			}
+		}
+		if err := s.Register(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestCommandService_Complete(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{
+			name: "not a command",
+			line: "Hello",
+			want: nil,
+		},
+		{
+			name: "command name",
+			line: ":te",
+			want: []string{":testgen"},
+		},
+		{
+			name: "file path",
+			line: ":findbugs testdata/ca",
+			want: []string{"testdata/calc.go"},
+		},
+		{
+			name: "directory",
+			line: ":findbugs testd",
+			want: []string{"testdata/"},
+		},
+		{
+			name: "function name",
+			line: ":testgen testdata/calc.go ",
+			want: []string{"Add", "Div"},
+		},
+		{
+			name: "function name with prefix",
+			line: ":testgen testdata/calc.go D",
+			want: []string{"Div"},
+		},
+		{
+			name: "function of missing file",
+			line: ":testgen testdata/missing.go ",
+			want: nil,
+		},
+		{
+			name: "alias",
+			line: ":tg testdata/calc.go A",
+			want: []string{"Add"},
+		},
+		{
+			name: "custom completion",
+			line: ":persona r",
+			want: []string{"reviewer"},
+		},
+		{
+			name: "unknown command",
+			line: ":review ",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestCommandService(t,
+				Command{Name: "testgen", Aliases: []string{"tg"}, Args: "<file> [function]"},
+				Command{Name: "findbugs", Args: "<file> [function]"},
+				Command{Name: "persona", Args: "[name]", Complete: func(args []string, word string) []string {
+					return filterPrefix([]string{"default", "reviewer"}, word)
+				}},
+			)
+			if got := s.Complete(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Complete(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// Argument names of custom commands which are handled specially
+const (
+	// argFile is the file whose code is sent
+	argFile = "file"
+	// argFunction is the function extracted from the file
+	argFunction = "function"
+)
+
+// CommandArg is an argument of custom commands
+type CommandArg struct {
+	Name     string
+	Optional bool
+	// Variadic takes the rest of the arguments joined with spaces
+	Variadic bool
+}
+
+// ParseArgSpec parses the argument spec of custom commands, e.g. "<file> [function]" or "<language> <text...>"
+// Arguments in '<>' are required and the ones in '[]' are optional
+func ParseArgSpec(spec string) ([]CommandArg, error) {
+	args := []CommandArg{}
+	for _, token := range strings.Fields(spec) {
+		var arg CommandArg
+		switch {
+		case strings.HasPrefix(token, "<") && strings.HasSuffix(token, ">"):
+		case strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]"):
+			arg.Optional = true
+		default:
+			return nil, fmt.Errorf("invalid argument %q: must be <name> or [name]", token)
+		}
+		arg.Name = token[1 : len(token)-1]
+		if strings.HasSuffix(arg.Name, "...") {
+			arg.Variadic = true
+			arg.Name = strings.TrimSuffix(arg.Name, "...")
+		}
+		if arg.Name == "" {
+			return nil, fmt.Errorf("invalid argument %q: name is empty", token)
+		}
+
+		if len(args) > 0 {
+			last := args[len(args)-1]
+			if last.Variadic {
+				return nil, fmt.Errorf("invalid argument %q: no argument can follow %s...", token, last.Name)
+			}
+			if last.Optional && !arg.Optional {
+				return nil, fmt.Errorf("invalid argument %q: required argument cannot follow optional one", token)
+			}
+		}
+		for _, other := range args {
+			if other.Name == arg.Name {
+				return nil, fmt.Errorf("duplicate argument %q", arg.Name)
+			}
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// CustomCommand is the command declared in the config, which sends the prompt rendered with the arguments
+type CustomCommand struct {
+	Name   string
+	Args   []CommandArg
+	Help   string
+	Params internal.ModelParams
+	Prompt *template.Template
+	// ExtractFunction sends the code of the function instead of the whole file
+	ExtractFunction bool
+}
+
+// Usage returns the argument spec of the command
+func (c CustomCommand) Usage() string {
+	return FormatArgSpec(c.Args)
+}
+
+type CustomCommandService interface {
+	SendRequestStream(ctx context.Context, args Args) error
+	Run(ctx context.Context, args Args, w io.Writer) error
+}
+
+func NewCustomCommandService(provider internal.Provider, command CustomCommand) CustomCommandService {
+	return &customCommandService{
+		provider: provider,
+		command:  command,
+	}
+}
+
+type customCommandService struct {
+	provider internal.Provider
+	command  CustomCommand
+}
+
+var _ CustomCommandService = (*customCommandService)(nil)
+
+// SendRequestStream sends the prompt rendered with the arguments in stream
+func (s *customCommandService) SendRequestStream(ctx context.Context, args Args) error {
+	req, err := s.newRequest(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("AI> ")
+	err = writeStream(ctx, s.provider, req, os.Stdout)
+	if isCanceled(ctx) {
+		fmt.Printf("\n(canceled)\n\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// Run sends the prompt rendered with the arguments and writes the answer to w without any decoration
+func (s *customCommandService) Run(ctx context.Context, args Args, w io.Writer) error {
+	req, err := s.newRequest(args)
+	if err != nil {
+		return err
+	}
+	return writeStream(ctx, s.provider, req, w)
+}
+
+// newRequest makes the request with the prompt rendered with the arguments
+// The code of the file is available to the prompt if the command has 'file' argument
+// The model and the language are overridden by the options
+func (s *customCommandService) newRequest(args Args) (internal.ChatRequest, error) {
+	params := s.command.Params
+	if model := args.Flag(FlagModel); model != "" {
+		if err := internal.ValidateModel(model); err != nil {
+			return internal.ChatRequest{}, err
+		}
+		params.Model = model
+	}
+
+	data := PromptData{}
+	if fileName := args.Value(argFile); fileName != "" {
+		funcName := ""
+		if s.command.ExtractFunction {
+			funcName = args.Value(argFunction)
+		}
+		var err error
+		data, err = newPromptData(fileName, funcName)
+		if err != nil {
+			return internal.ChatRequest{}, err
+		}
+	}
+	if lang := args.Flag(FlagLang); lang != "" {
+		data.Language = lang
+	}
+	data.FuncName = args.Value(argFunction)
+	data.Args = args.Values()
+
+	messageBody, err := executePrompt(s.command.Prompt, data)
+	if err != nil {
+		return internal.ChatRequest{}, err
+	}
+	if strings.TrimSpace(messageBody) == "" {
+		return internal.ChatRequest{}, errors.New("the prompt is empty")
+	}
+	return internal.ChatRequest{
+		ModelParams: params,
+		Messages: []internal.Message{
+			{
+				Role:    internal.RoleUser,
+				Content: messageBody,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,183 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestParseArgSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []CommandArg
+		wantErr bool
+	}{
+		{
+			spec: "",
+			want: []CommandArg{},
+		},
+		{
+			spec: "<file> [function]",
+			want: []CommandArg{{Name: "file"}, {Name: "function", Optional: true}},
+		},
+		{
+			spec: "<language> <text...>",
+			want: []CommandArg{{Name: "language"}, {Name: "text", Variadic: true}},
+		},
+		{
+			spec: "  <file>   [function]  ",
+			want: []CommandArg{{Name: "file"}, {Name: "function", Optional: true}},
+		},
+		{
+			spec: "[text...]",
+			want: []CommandArg{{Name: "text", Optional: true, Variadic: true}},
+		},
+		{spec: "file", wantErr: true},
+		{spec: "<file", wantErr: true},
+		{spec: "[...]", wantErr: true},
+		{spec: "<>", wantErr: true},
+		{spec: "<text...> <language>", wantErr: true},
+		{spec: "[function] <file>", wantErr: true},
+		{spec: "<file> [file]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseArgSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseArgSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseArgSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomCommandService_Run(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		// prompt is the template of the prompt
+		prompt          string
+		extractFunction bool
+		args            []string
+		// wantMessage is the content of the request, or no request is sent if empty
+		wantMessage string
+		wantErr     bool
+	}{
+		{
+			name:        "variadic argument",
+			spec:        "<language> <text...>",
+			prompt:      "Translate into {{.Args.language}}: {{.Args.text}}",
+			args:        []string{"Japanese", "Hello,", "world"},
+			wantMessage: "Translate into Japanese: Hello, world",
+		},
+		{
+			name:            "code of the function",
+			spec:            "<file> [function]",
+			prompt:          "Explain {{.FuncName}} in {{.Language}}\n{{.Code}}",
+			extractFunction: true,
+			args:            []string{"testdata/calc.go", "Div"},
+			wantMessage:     "Explain Div in Go\ntestdata/calc.go:9-11 (Div)\n```\nfunc Div(a, b int) int {\n\treturn a / b\n}\n```",
+		},
+		{
+			name:        "omitted optional argument",
+			spec:        "<language> [style]",
+			prompt:      "Write in {{.Args.language}}{{with .Args.style}} in {{.}} style{{end}}",
+			args:        []string{"Go"},
+			wantMessage: "Write in Go",
+		},
+		{
+			name:            "language option",
+			spec:            "<file> [function]",
+			prompt:          "Explain {{.FuncName}} in {{.Language}}",
+			extractFunction: true,
+			args:            []string{"--lang=Golang", "testdata/calc.go", "Add"},
+			wantMessage:     "Explain Add in Golang",
+		},
+		{
+			name:    "unknown option",
+			spec:    "<language>",
+			prompt:  "Write in {{.Args.language}}",
+			args:    []string{"--style=short", "Go"},
+			wantErr: true,
+		},
+		{
+			name:    "missing argument",
+			spec:    "<language> <text...>",
+			prompt:  "Translate into {{.Args.language}}: {{.Args.text}}",
+			args:    []string{"Japanese"},
+			wantErr: true,
+		},
+		{
+			name:    "too many arguments",
+			spec:    "<language>",
+			prompt:  "Write in {{.Args.language}}",
+			args:    []string{"Go", "Rust"},
+			wantErr: true,
+		},
+		{
+			name:    "empty prompt",
+			spec:    "[text]",
+			prompt:  "{{.Args.text}}",
+			args:    []string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := ParseArgSpec(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, arg := range args {
+				names = append(names, arg.Name)
+			}
+			prompt, err := ParsePrompt(tt.name, tt.prompt, names...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv, provider := newTestProvider(t, 0, fakeopenai.Response{Content: "OK"})
+			flags := []CommandFlag{{Name: FlagModel, Value: "model"}, {Name: FlagLang, Value: "lang"}}
+			s := NewCustomCommandService(provider, CustomCommand{
+				Name:            "custom",
+				Args:            args,
+				Params:          internal.ModelParams{Model: internal.DefaultModel},
+				Prompt:          prompt,
+				ExtractFunction: tt.extractFunction,
+			})
+
+			var out bytes.Buffer
+			parsed, err := ParseArgs(args, flags, tt.args)
+			if err == nil {
+				err = s.Run(context.Background(), parsed, &out)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if tt.wantErr {
+				if len(requests) != 0 {
+					t.Errorf("requests = %d, want 0", len(requests))
+				}
+				return
+			}
+			if len(requests) != 1 {
+				t.Fatalf("requests = %d, want 1", len(requests))
+			}
+			want := []internal.Message{user(tt.wantMessage)}
+			if got := requestMessages(requests[0]); !reflect.DeepEqual(got, want) {
+				t.Errorf("messages = %q, want %q", got, want)
+			}
+			if got := out.String(); got != "OK\n" {
+				t.Errorf("output = %q, want %q", got, "OK\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// Retry regenerates the latest answer
+// The new answer forks a branch, so the previous answer is kept as an alternate
+func (s *chatService) Retry(ctx context.Context) error {
+	node, ok := s.lastUserNode()
+	if !ok {
+		return errors.New("no message to retry")
+	}
+	return s.fork(ctx, node, nil)
+}
+
+// EditLastMessage replaces the latest user message with text and resends it
+func (s *chatService) EditLastMessage(ctx context.Context, text string) error {
+	node, ok := s.lastUserNode()
+	if !ok {
+		return errors.New("no message to edit")
+	}
+	return s.editMessage(ctx, node, text)
+}
+
+// EditMessage replaces the user message of id with text and resends it
+// This forks a new branch from the parent of the message
+func (s *chatService) EditMessage(ctx context.Context, id int, text string) error {
+	node, err := s.userNode(id)
+	if err != nil {
+		return err
+	}
+	return s.editMessage(ctx, node, text)
+}
+
+// LastUserMessage returns the latest user message
+func (s *chatService) LastUserMessage() (string, error) {
+	node, ok := s.lastUserNode()
+	if !ok {
+		return "", errors.New("no message to edit")
+	}
+	return node.Content, nil
+}
+
+// UserMessage returns the user message of id
+func (s *chatService) UserMessage(id int) (string, error) {
+	node, err := s.userNode(id)
+	if err != nil {
+		return "", err
+	}
+	return node.Content, nil
+}
+
+// Undo removes the latest user message and its answer on the active conversation
+// The messages which other branches fork from are kept with those branches
+func (s *chatService) Undo() error {
+	node, ok := s.lastUserNode()
+	if !ok {
+		return errors.New("no message to undo")
+	}
+	s.history.prune(node)
+	s.autoSaveSession()
+	return nil
+}
+
+// ShowAlternates prints the answers to the latest user message
+func (s *chatService) ShowAlternates() error {
+	answers, err := s.lastAnswers()
+	if err != nil {
+		return err
+	}
+	for i, answer := range answers {
+		mark := " "
+		if s.history.isActive(answer) {
+			mark = "*"
+		}
+		fmt.Printf("%s[%d]\n%s\n\n", mark, i+1, answer.Content)
+	}
+	return nil
+}
+
+// SelectAlternate switches the latest answer to the answer of index n
+func (s *chatService) SelectAlternate(n int) error {
+	answers, err := s.lastAnswers()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > len(answers) {
+		return fmt.Errorf("alternate %d not found", n)
+	}
+	s.history.current = s.history.latestLeaf(answers[n-1])
+	fmt.Printf("AI> %v\n\n", answers[n-1].Content)
+	s.autoSaveSession()
+	return nil
+}
+
+// editMessage forks a new branch with text from the parent of the user message
+func (s *chatService) editMessage(ctx context.Context, node *historyNode, text string) error {
+	edited := &internal.Message{
+		Role:    internal.RoleUser,
+		Content: text,
+	}
+	return s.fork(ctx, node.parent, edited)
+}
+
+// fork moves to parent, adds the user message if any and regenerates the answer
+// If regenerating fails, the new branch is removed and the previous position is restored
+func (s *chatService) fork(ctx context.Context, parent *historyNode, userMessage *internal.Message) error {
+	previous := s.history.current
+	s.history.current = parent
+
+	var added *historyNode
+	if userMessage != nil {
+		added = s.history.add(*userMessage)
+	}
+	if err := s.respond(ctx); err != nil {
+		if added != nil {
+			s.history.remove(added)
+		}
+		s.history.current = previous
+		return err
+	}
+	s.autoSaveSession()
+	return nil
+}
+
+// userNode returns the user message of id
+func (s *chatService) userNode(id int) (*historyNode, error) {
+	node, ok := s.history.nodes[id]
+	if !ok {
+		return nil, fmt.Errorf("message %d not found", id)
+	}
+	if node.Role != internal.RoleUser {
+		return nil, fmt.Errorf("message %d is not a user message", id)
+	}
+	return node, nil
+}
+
+// lastAnswers returns the answers to the latest user message
+func (s *chatService) lastAnswers() ([]*historyNode, error) {
+	node, ok := s.lastUserNode()
+	if !ok || len(node.children) == 0 {
+		return nil, errors.New("no answer")
+	}
+	return node.children, nil
+}
@@ -0,0 +1,204 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestChatService_Edit(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []internal.Message
+		// edit edits the conversation
+		edit      func(ctx context.Context, s *chatService) error
+		responses []fakeopenai.Response
+		// wantMessages are the messages of the last request, if any
+		wantMessages []internal.Message
+		wantHistory  []internal.Message
+		// wantAnswers are the answers to the latest user message, if any
+		wantAnswers []string
+		wantErr     bool
+	}{
+		{
+			name:     "retry",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				return s.Retry(ctx)
+			},
+			responses:    []fakeopenai.Response{{Content: "Hello!"}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hello!")},
+			wantAnswers:  []string{"Hi!", "Hello!"},
+		},
+		{
+			name:     "retry keeps previous alternates",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				if err := s.Retry(ctx); err != nil {
+					return err
+				}
+				return s.Retry(ctx)
+			},
+			responses:    []fakeopenai.Response{{Content: "Hello!"}, {Content: "Hey"}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hey")},
+			wantAnswers:  []string{"Hi!", "Hello!", "Hey"},
+		},
+		{
+			name:     "failed retry restores the turn",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				return s.Retry(ctx)
+			},
+			responses:    []fakeopenai.Response{{Content: "unavailable", StatusCode: http.StatusServiceUnavailable}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+			wantErr:      true,
+		},
+		{
+			name:     "edit",
+			previous: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+			edit: func(ctx context.Context, s *chatService) error {
+				return s.EditLastMessage(ctx, "Who are you?")
+			},
+			responses:    []fakeopenai.Response{{Content: "A bot"}},
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("Who are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("Who are you?"), assistant("A bot")},
+			wantAnswers:  []string{"A bot"},
+		},
+		{
+			name:     "checkout the branch before edit",
+			previous: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+			edit: func(ctx context.Context, s *chatService) error {
+				if err := s.EditLastMessage(ctx, "Who are you?"); err != nil {
+					return err
+				}
+				return s.Checkout(1)
+			},
+			responses:    []fakeopenai.Response{{Content: "A bot"}},
+			wantMessages: []internal.Message{user("Hello"), assistant("Hi!"), user("Who are you?")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+			wantAnswers:  []string{"Fine"},
+		},
+		{
+			name:     "branches in order of creation",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				if err := s.Retry(ctx); err != nil {
+					return err
+				}
+				if err := s.Checkout(1); err != nil {
+					return err
+				}
+				s.history.add(user("How are you?"))
+				s.history.add(assistant("Fine"))
+				return s.Checkout(2)
+			},
+			responses:    []fakeopenai.Response{{Content: "Hello!"}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+			wantAnswers:  []string{"Fine"},
+		},
+		{
+			name:     "select alternate",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				if err := s.Retry(ctx); err != nil {
+					return err
+				}
+				return s.SelectAlternate(1)
+			},
+			responses:    []fakeopenai.Response{{Content: "Hello!"}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+			wantAnswers:  []string{"Hi!", "Hello!"},
+		},
+		{
+			name:     "undo",
+			previous: []internal.Message{user("Hello"), assistant("Hi!"), user("How are you?"), assistant("Fine")},
+			edit: func(ctx context.Context, s *chatService) error {
+				return s.Undo()
+			},
+			wantHistory: []internal.Message{user("Hello"), assistant("Hi!")},
+		},
+		{
+			name:     "undo keeps the other branches",
+			previous: []internal.Message{user("Hello"), assistant("Hi!")},
+			edit: func(ctx context.Context, s *chatService) error {
+				if err := s.Retry(ctx); err != nil {
+					return err
+				}
+				s.history.add(user("How are you?"))
+				s.history.add(assistant("Fine"))
+				if err := s.Checkout(1); err != nil {
+					return err
+				}
+				if err := s.Undo(); err != nil {
+					return err
+				}
+				if leaves := s.history.leaves(); len(leaves) != 1 {
+					return fmt.Errorf("branches = %d, want 1", len(leaves))
+				}
+				return s.Checkout(1)
+			},
+			responses:    []fakeopenai.Response{{Content: "Hello!"}},
+			wantMessages: []internal.Message{user("Hello")},
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hello!"), user("How are you?"), assistant("Fine")},
+			wantAnswers:  []string{"Fine"},
+		},
+		{
+			name: "nothing to undo",
+			edit: func(ctx context.Context, s *chatService) error {
+				return s.Undo()
+			},
+			wantHistory: []internal.Message{},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, 0, tt.responses...)
+			s := newTestChatService(t, provider, ChatConfig{})
+			for _, msg := range tt.previous {
+				s.history.add(msg)
+			}
+
+			err := tt.edit(context.Background(), s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != len(tt.responses) {
+				t.Fatalf("requests = %d, want %d", len(requests), len(tt.responses))
+			}
+			if len(requests) > 0 {
+				if got := requestMessages(requests[len(requests)-1]); !reflect.DeepEqual(got, tt.wantMessages) {
+					t.Errorf("messages = %v, want %v", got, tt.wantMessages)
+				}
+			}
+			if got := historyMessages(s); !reflect.DeepEqual(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+			if tt.wantAnswers != nil {
+				answers, err := s.lastAnswers()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, answer := range answers {
+					got = append(got, answer.Content)
+				}
+				if !reflect.DeepEqual(got, tt.wantAnswers) {
+					t.Errorf("answers = %v, want %v", got, tt.wantAnswers)
+				}
+			}
+		})
+	}
+}
@@ -5,23 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strings"
+	"text/template"
 
-	"github.com/sashabaranov/go-openai"
 	"github.com/sota0121/go-ai-chat/internal"
-	"golang.org/x/exp/slog"
 )
 
 type FindBugService interface {
-	SendRequestStream(ctx context.Context, text string) error
+	SendRequestStream(ctx context.Context, req CodeRequest) error
+	FindBugs(ctx context.Context, req CodeRequest, w io.Writer) error
 }
 
-func NewFindBugService() FindBugService {
-	return &findBugService{}
+// NewFindBugService creates FindBugService
+// The built-in prompt is used if prompt is nil
+func NewFindBugService(provider internal.Provider, params internal.ModelParams, prompt *template.Template) FindBugService {
+	if prompt == nil {
+		prompt = defaultFindBugsPrompt
+	}
+	return &findBugService{
+		provider: provider,
+		params:   params,
+		prompt:   prompt,
+	}
 }
 
 type findBugService struct {
+	provider internal.Provider
+	params   internal.ModelParams
+	prompt   *template.Template
 }
 
 var _ FindBugService = (*findBugService)(nil)
@@ -33,102 +43,74 @@ const (
 	`
 )
 
-// SendRequestStream sends request to OpenAI to find bugs in stream
-// This expects text to be in the following format:
-// :findbugs <file> or :testgen <file> <function>
-func (s *findBugService) SendRequestStream(ctx context.Context, text string) error {
-	// Parse input text
-	fileName, funcName, err := s.parseInput(text)
-	if err != nil {
-		return err
-	}
-
-	// Read file
-	file, err := os.Open(fileName)
+// SendRequestStream sends request to the provider to find bugs in stream
+// If the function name of req is empty, the whole file is sent
+func (s *findBugService) SendRequestStream(ctx context.Context, req CodeRequest) error {
+	chatReq, err := s.newRequest(req)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.New("file not found")
-		}
 		return err
 	}
 
-	// Get program code
-	code, err := extractCode(file, funcName)
-	if err != nil {
-		slog.Error("Error extracting code", err)
-		return err
+	stream, err := s.provider.CreateChatCompletionStream(ctx, chatReq)
+	if err == nil {
+		defer stream.Close()
 	}
-
-	// Make message body
-	messageBody := fmt.Sprintf("%s\n\n%s", findBugsMessageHeader, code)
-
-	// Get OpenAI client from context
-	openaiClient := internal.GetOpenAIClientFromContext(ctx)
-
-	// Send request to OpenAI in stream
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: messageBody,
-			},
-		},
-		Stream: true,
+	if isCanceled(ctx) {
+		fmt.Println("(canceled)")
+		return nil
 	}
-
-	stream, err := openaiClient.CreateChatCompletionStream(ctx, req)
 	if err != nil {
-		slog.Error("Error creating chat completion stream", err)
 		return err
 	}
-	defer stream.Close()
 
 	fmt.Printf("AI> ")
 	for {
-		response, err := stream.Recv()
+		token, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
 			fmt.Printf("\n\n")
 			return nil
 		}
+		if isCanceled(ctx) {
+			fmt.Printf("\n(canceled)\n\n")
+			return nil
+		}
 		if err != nil {
-			slog.Error("Error receiving chat completion stream", err)
 			return err
 		}
 
-		if len(response.Choices) == 0 {
-			continue
-		}
-		fmt.Printf("%v", response.Choices[0].Delta.Content)
+		fmt.Printf("%v", token)
 	}
 }
 
-// parseInput parses input text
-// [FIXME] This method is duplicated in test_gen.go
-func (s *findBugService) parseInput(text string) (string, string, error) {
-	// Check if text is in the correct format
-	if err := s.checkInput(text); err != nil {
-		return "", "", err
-	}
-
-	// Parse text
-	tokens := strings.Split(text, " ")
-	fileName := tokens[1]
-	funcName := ""
-	if len(tokens) > 2 {
-		funcName = tokens[2]
+// FindBugs finds bugs in the function of the file, or the whole file if funcName is empty
+// The answer is written to w in stream without any decoration
+func (s *findBugService) FindBugs(ctx context.Context, req CodeRequest, w io.Writer) error {
+	chatReq, err := s.newRequest(req)
+	if err != nil {
+		return err
 	}
-	return fileName, funcName, nil
+	return writeStream(ctx, s.provider, chatReq, w)
 }
 
-// checkInput checks input text
-func (s *findBugService) checkInput(text string) error {
-	if !strings.HasPrefix(text, ":findbugs") {
-		return errors.New("invalid format: text must start with ':findbugs'")
+// newRequest makes the request with the code of the function in the file
+// If the function name is empty, the whole file is used
+func (s *findBugService) newRequest(req CodeRequest) (internal.ChatRequest, error) {
+	params, err := requestParams(s.params, req)
+	if err != nil {
+		return internal.ChatRequest{}, err
 	}
-	tokens := strings.Split(text, " ")
-	if len(tokens) < 2 {
-		return errors.New("invalid format: text must contain file name")
+	messageBody, err := renderPrompt(s.prompt, req)
+	if err != nil {
+		return internal.ChatRequest{}, err
 	}
-	return nil
+
+	return internal.ChatRequest{
+		ModelParams: params,
+		Messages: []internal.Message{
+			{
+				Role:    internal.RoleUser,
+				Content: messageBody,
+			},
+		},
+	}, nil
 }
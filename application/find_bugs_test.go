@@ -0,0 +1,175 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestFindBugService_FindBugs(t *testing.T) {
+	calc, err := os.ReadFile("testdata/calc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fileName string
+		funcName string
+		// model overrides the model of the service if not empty
+		model string
+		// prompt is the template of the prompt, or the built-in one if empty
+		prompt    string
+		responses []fakeopenai.Response
+		// wantRequests is the number of requests received by the server
+		wantRequests int
+		wantMessages []internal.Message
+		wantOutput   string
+		wantErr      bool
+	}{
+		{
+			name:         "whole file",
+			fileName:     "testdata/calc.go",
+			responses:    []fakeopenai.Response{{Tokens: []string{"Div panics", " when b is 0"}}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user(findBugsMessageHeader + "\n\ntestdata/calc.go:1-11\n```\n" + string(calc) + "```"),
+			},
+			wantOutput: "Div panics when b is 0\n",
+		},
+		{
+			name:         "function",
+			fileName:     "testdata/calc.go",
+			funcName:     "Div",
+			responses:    []fakeopenai.Response{{Content: "Div panics when b is 0"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user(findBugsMessageHeader + "\n\ntestdata/calc.go:9-11 (Div)\n```\nfunc Div(a, b int) int {\n\treturn a / b\n}\n```"),
+			},
+			wantOutput: "Div panics when b is 0\n",
+		},
+		{
+			name:         "method",
+			fileName:     "testdata/shapes.go",
+			funcName:     "(*Rect).Area",
+			responses:    []fakeopenai.Response{{Content: "No bugs"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user(findBugsMessageHeader + "\n\ntestdata/shapes.go:56-58 (Rect.Area)\n```\nfunc (r *Rect) Area() float64 {\n\treturn r.W * r.H\n}\n```"),
+			},
+			wantOutput: "No bugs\n",
+		},
+		{
+			name:         "ambiguous method",
+			fileName:     "testdata/shapes.go",
+			funcName:     "Area",
+			wantRequests: 0,
+			wantErr:      true,
+		},
+		{
+			name:         "custom prompt",
+			fileName:     "testdata/calc.go",
+			funcName:     "Add",
+			prompt:       "Find bugs in {{.Language}} {{.Package}}.{{.FuncName}} of {{.FileName}}:\n{{.Code}}",
+			responses:    []fakeopenai.Response{{Content: "No bugs"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user("Find bugs in Go calc.Add of testdata/calc.go:\ntestdata/calc.go:4-6 (Add)\n```\nfunc Add(a, b int) int {\n\treturn a + b\n}\n```"),
+			},
+			wantOutput: "No bugs\n",
+		},
+		{
+			name:         "model override",
+			fileName:     "testdata/calc.go",
+			funcName:     "Div",
+			model:        "gpt-4",
+			responses:    []fakeopenai.Response{{Content: "Div panics when b is 0"}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user(findBugsMessageHeader + "\n\ntestdata/calc.go:9-11 (Div)\n```\nfunc Div(a, b int) int {\n\treturn a / b\n}\n```"),
+			},
+			wantOutput: "Div panics when b is 0\n",
+		},
+		{
+			name:     "unknown model",
+			fileName: "testdata/calc.go",
+			model:    "gpt-5",
+			wantErr:  true,
+		},
+		{
+			name:         "file not found",
+			fileName:     "testdata/missing.go",
+			wantRequests: 0,
+			wantErr:      true,
+		},
+		{
+			name:         "function not found",
+			fileName:     "testdata/calc.go",
+			funcName:     "Mul",
+			wantRequests: 0,
+			wantErr:      true,
+		},
+		{
+			name:         "server error",
+			fileName:     "testdata/calc.go",
+			funcName:     "Div",
+			responses:    []fakeopenai.Response{{Content: "unavailable", StatusCode: http.StatusServiceUnavailable}},
+			wantRequests: 1,
+			wantMessages: []internal.Message{
+				user(findBugsMessageHeader + "\n\ntestdata/calc.go:9-11 (Div)\n```\nfunc Div(a, b int) int {\n\treturn a / b\n}\n```"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, 0, tt.responses...)
+			var prompt *template.Template
+			if tt.prompt != "" {
+				prompt, err = ParsePrompt("findbugs", tt.prompt)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := NewFindBugService(provider, internal.ModelParams{Model: internal.DefaultModel}, prompt)
+
+			var out bytes.Buffer
+			req := CodeRequest{FileName: tt.fileName, FuncName: tt.funcName, Model: tt.model}
+			err := s.FindBugs(context.Background(), req, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindBugs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			if tt.wantRequests == 0 {
+				return
+			}
+			if !requests[0].Stream {
+				t.Errorf("request is not in stream")
+			}
+			wantModel := internal.DefaultModel
+			if tt.model != "" {
+				wantModel = tt.model
+			}
+			if requests[0].Model != wantModel {
+				t.Errorf("model = %q, want %q", requests[0].Model, wantModel)
+			}
+			if got := requestMessages(requests[0]); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("messages = %q, want %q", got, tt.wantMessages)
+			}
+			if got := out.String(); !tt.wantErr && got != tt.wantOutput {
+				t.Errorf("output = %q, want %q", got, tt.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package application
+
+import (
+	"errors"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+const (
+	// defaultReplyTokens is reserved for the reply when max tokens is not set
+	defaultReplyTokens = 512
+)
+
+// tokenBudget returns the number of tokens available for the prompt
+func (s *chatService) tokenBudget() int {
+	reserved := s.params.MaxTokens
+	if reserved == 0 {
+		reserved = defaultReplyTokens
+	}
+	return internal.ContextSize(s.params.Model) - reserved
+}
+
+// histories returns the messages of the active conversation which are not merged into its summary
+func (s *chatService) histories() []*historyNode {
+	summary, summarized := s.summaryNode()
+	histories := []*historyNode{}
+	for _, node := range s.history.path() {
+		if !summarized || node.Pinned {
+			histories = append(histories, node)
+		}
+		if node == summary {
+			summarized = false
+		}
+	}
+	return histories
+}
+
+// trimHistories trims the oldest turns of histories until the prompt fits in the token budget
+// System messages, user messages, pinned turns and the latest turn are never trimmed
+// The trimmed turns are not recorded, so that they are sent again once they fit, e.g. after the model is changed
+// This returns the histories kept and trimmed
+func (s *chatService) trimHistories(histories []*historyNode) ([]*historyNode, []*historyNode) {
+	trimmed := []*historyNode{}
+	for s.tokenizer.CountMessageTokens(s.messages(histories)) > s.tokenBudget() {
+		start, end, ok := oldestTrimmableTurn(histories)
+		if !ok {
+			break
+		}
+		trimmed = append(trimmed, histories[start:end]...)
+		histories = append(histories[:start:start], histories[end:]...)
+	}
+	return histories, trimmed
+}
+
+// oldestTrimmableTurn returns the range of the oldest turn in histories which can be trimmed
+// A turn starts with a user message and continues until the next user message
+func oldestTrimmableTurn(histories []*historyNode) (int, int, bool) {
+	start := 0
+	for start < len(histories) {
+		end := start + 1
+		for end < len(histories) && histories[end].Role != internal.RoleUser {
+			end++
+		}
+		// The latest turn is always kept
+		if end == len(histories) {
+			return 0, 0, false
+		}
+		if !histories[start].Pinned {
+			return start, end, true
+		}
+		start = end
+	}
+	return 0, 0, false
+}
+
+// lastUserNode returns the latest user message in the active conversation
+func (s *chatService) lastUserNode() (*historyNode, bool) {
+	path := s.history.path()
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Role == internal.RoleUser {
+			return path[i], true
+		}
+	}
+	return nil, false
+}
+
+// PinLastTurn pins the latest turn so that it is never trimmed
+func (s *chatService) PinLastTurn() error {
+	node, ok := s.lastUserNode()
+	if !ok {
+		return errors.New("no message to pin")
+	}
+	for n := s.history.current; n != node.parent; n = n.parent {
+		n.Pinned = true
+	}
+	s.autoSaveSession()
+	return nil
+}
@@ -0,0 +1,159 @@
+package application
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// PromptData is the variables available to the prompt templates of code commands
+type PromptData struct {
+	// FileName is the file argument as specified by the user, e.g. main.go, main.go:40-85 or *.go
+	FileName string
+	// FuncName is the function name, or empty for the whole file
+	FuncName string
+	// Package is the package name of Go files, or empty for the other files
+	Package string
+	// Language is the language name guessed from the file extension, e.g. Go
+	Language string
+	// Code is the source code of the regions, each labeled with its file name and line numbers
+	Code string
+	// Regions are the regions of the code
+	Regions []CodeRegion
+	// Framework is the test framework given by --framework, or empty
+	Framework string
+	// Args are the arguments of custom commands by names
+	Args map[string]string
+}
+
+// CodeRequest is the code sent by code commands and their options
+type CodeRequest struct {
+	FileName string
+	// FuncName is the function name, or empty for the whole file
+	FuncName string
+	// Model overrides the model of the command if not empty
+	Model string
+	// Language overrides the language guessed from the file extension if not empty
+	Language string
+	// Framework is the test framework if not empty
+	Framework string
+}
+
+// languages are the language names by file extensions
+var languages = map[string]string{
+	".go":   "Go",
+	".py":   "Python",
+	".js":   "JavaScript",
+	".ts":   "TypeScript",
+	".java": "Java",
+	".rb":   "Ruby",
+	".rs":   "Rust",
+	".c":    "C",
+	".cpp":  "C++",
+	".cs":   "C#",
+	".sh":   "Shell",
+}
+
+// Built-in prompt templates
+var (
+	defaultFindBugsPrompt = template.Must(ParsePrompt("findbugs", findBugsMessageHeader+"\n\n{{.Code}}"))
+	defaultTestGenPrompt  = template.Must(ParsePrompt("testgen", tesgGenMessageHeader+testGenFrameworkMessage+"\n\n{{.Code}}"))
+)
+
+// ParsePrompt parses the prompt template of code commands with the argument names of custom commands
+// The template is executed with sample data so that unknown variables are reported before use
+func ParsePrompt(name, text string, args ...string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := PromptData{
+		FileName:  "main.go",
+		FuncName:  "main",
+		Package:   "main",
+		Language:  "Go",
+		Code:      "func main() {}",
+		Regions:   []CodeRegion{{FileName: "main.go", Name: "main", StartLine: 1, EndLine: 1, Code: "func main() {}"}},
+		Framework: "testing",
+		Args:      map[string]string{},
+	}
+	for _, arg := range args {
+		sample.Args[arg] = arg
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderPrompt renders the prompt with the code of the request
+// If the function name is empty, the whole file is used
+func renderPrompt(prompt *template.Template, req CodeRequest) (string, error) {
+	data, err := newPromptData(req.FileName, req.FuncName)
+	if err != nil {
+		return "", err
+	}
+	if req.Language != "" {
+		data.Language = req.Language
+	}
+	data.Framework = req.Framework
+	return executePrompt(prompt, data)
+}
+
+// requestParams returns the parameters with the model of the request if specified
+func requestParams(params internal.ModelParams, req CodeRequest) (internal.ModelParams, error) {
+	if req.Model == "" {
+		return params, nil
+	}
+	if err := internal.ValidateModel(req.Model); err != nil {
+		return internal.ModelParams{}, err
+	}
+	params.Model = req.Model
+	return params, nil
+}
+
+// newPromptData reads the code of the file argument, which can have lines, declarations or a glob pattern
+// If funcName is not empty, the declaration of the name is used
+// The package and the language are of the first file
+func newPromptData(fileName, funcName string) (PromptData, error) {
+	regions, err := readRegions(fileName, funcName)
+	if err != nil {
+		return PromptData{}, err
+	}
+
+	first := regions[0].FileName
+	return PromptData{
+		FileName: fileName,
+		FuncName: funcName,
+		Package:  packageName(first),
+		Language: languages[strings.ToLower(filepath.Ext(first))],
+		Code:     formatRegions(regions),
+		Regions:  regions,
+		Args:     map[string]string{},
+	}, nil
+}
+
+// executePrompt renders the prompt with the data
+func executePrompt(prompt *template.Template, data PromptData) (string, error) {
+	var b strings.Builder
+	if err := prompt.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// packageName returns the package name of the Go file, or empty string for the other files
+func packageName(fileName string) string {
+	if filepath.Ext(fileName) != ".go" {
+		return ""
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), fileName, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return f.Name.Name
+}
@@ -0,0 +1,40 @@
+package application
+
+import (
+	"testing"
+)
+
+func TestParsePrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{
+			name: "all variables",
+			text: "{{.Language}} {{.Package}} {{.FileName}} {{.FuncName}}\n{{.Code}}",
+		},
+		{
+			name: "condition",
+			text: "{{if .FuncName}}Check {{.FuncName}}{{else}}Check the file{{end}}\n{{.Code}}",
+		},
+		{
+			name:    "unknown variable",
+			text:    "{{.Function}}\n{{.Code}}",
+			wantErr: true,
+		},
+		{
+			name:    "syntax error",
+			text:    "{{.Code}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePrompt("findbugs", tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePrompt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// LatestSessionID is an alias of the most recently updated session
+	LatestSessionID = "latest"
+)
+
+// SaveSession saves the conversation to the session store
+// Once saved, the session is saved automatically after each turn
+func (s *chatService) SaveSession() error {
+	if err := s.saveSession(); err != nil {
+		return err
+	}
+	fmt.Printf("Saved session %s\n", s.session.ID)
+	return nil
+}
+
+// autoSaveSession saves the session if it has been saved or loaded before
+func (s *chatService) autoSaveSession() {
+	if s.session == nil {
+		return
+	}
+	if err := s.saveSession(); err != nil {
+		slog.Error("Error auto saving session", err)
+	}
+}
+
+// saveSession saves the current conversation as the session
+func (s *chatService) saveSession() error {
+	now := time.Now()
+	if s.session == nil {
+		s.session = &internal.Session{
+			ID:        internal.NewSessionID(now),
+			CreatedAt: now,
+		}
+	}
+
+	s.session.Model = s.params.Model
+	s.session.SystemMessages = messageContents(s.SystemMessages)
+	s.session.UserMessages = messageContents(s.UserMessages)
+	s.session.Nodes = sessionNodes(s.history)
+	s.session.CurrentID = s.history.current.ID
+	s.session.UpdatedAt = now
+
+	return s.store.Save(s.session)
+}
+
+// SessionInfo is the overview of a saved session
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Model     string    `json:"model"`
+	Messages  int       `json:"messages"`
+	Preview   string    `json:"preview"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Sessions returns the overviews of saved sessions in order of last update
+func (s *chatService) Sessions() ([]SessionInfo, error) {
+	sessions, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:        session.ID,
+			Model:     session.Model,
+			Messages:  len(session.Nodes),
+			Preview:   sessionPreview(session),
+			CreatedAt: session.CreatedAt,
+			UpdatedAt: session.UpdatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// ListSessions prints saved sessions in order of last update
+func (s *chatService) ListSessions() error {
+	sessions, err := s.Sessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No saved sessions")
+		return nil
+	}
+
+	for _, session := range sessions {
+		fmt.Printf("%s  %s  %-16s %3d messages  %s\n",
+			session.ID,
+			session.UpdatedAt.Local().Format(time.DateTime),
+			session.Model,
+			session.Messages,
+			session.Preview,
+		)
+	}
+	return nil
+}
+
+// LoadSession restores the conversation from the session store
+// The preamble and model recorded in the session are restored as well
+func (s *chatService) LoadSession(id string) error {
+	session, err := s.findSession(id)
+	if err != nil {
+		return err
+	}
+
+	history, err := historyTreeFromSession(session)
+	if err != nil {
+		return err
+	}
+
+	// The model is validated and the tokenizer is rebuilt as Set does
+	model := s.params.Model
+	if session.Model != "" {
+		if err := internal.ValidateModel(session.Model); err != nil {
+			return err
+		}
+		model = session.Model
+	}
+	tokenizer, err := internal.NewTokenizer(model)
+	if err != nil {
+		return err
+	}
+
+	s.params.Model = model
+	s.tokenizer = tokenizer
+	s.SystemMessages = toMessages(internal.RoleSystem, session.SystemMessages)
+	s.UserMessages = toMessages(internal.RoleUser, session.UserMessages)
+	s.history = history
+	s.session = session
+
+	fmt.Printf("Loaded session %s (%d messages)\n", session.ID, len(history.nodes))
+	return nil
+}
+
+// findSession finds the session by id
+func (s *chatService) findSession(id string) (*internal.Session, error) {
+	if id != LatestSessionID {
+		return s.store.Load(id)
+	}
+
+	sessions, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("no saved sessions")
+	}
+	return sessions[0], nil
+}
+
+// sessionPreview returns the beginning of the first message in the session
+func sessionPreview(session *internal.Session) string {
+	for _, node := range session.Nodes {
+		if node.Role == internal.RoleUser {
+			return preview(node.Content)
+		}
+	}
+	return ""
+}
+
+// sessionNodes converts the conversation tree to session nodes
+func sessionNodes(t *historyTree) []internal.SessionNode {
+	nodes := make([]internal.SessionNode, 0, len(t.nodes))
+	t.walk(t.root, func(n *historyNode, _ int) {
+		if n == t.root {
+			return
+		}
+		nodes = append(nodes, internal.SessionNode{
+			ID:        n.ID,
+			ParentID:  n.parent.ID,
+			Role:      n.Role,
+			Content:   n.Content,
+			Pinned:    n.Pinned,
+			Summary:   n.Summary,
+			Truncated: n.Truncated,
+		})
+	})
+	return nodes
+}
+
+// historyTreeFromSession restores the conversation tree from the session
+func historyTreeFromSession(session *internal.Session) (*historyTree, error) {
+	t := newHistoryTree()
+	for _, sn := range session.Nodes {
+		parent, ok := t.nodes[sn.ParentID]
+		if sn.ParentID == t.root.ID {
+			parent, ok = t.root, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("broken session %s: parent of message %d not found", session.ID, sn.ID)
+		}
+		t.attach(parent, &historyNode{
+			Message: internal.Message{
+				Role:    sn.Role,
+				Content: sn.Content,
+			},
+			ID:        sn.ID,
+			Pinned:    sn.Pinned,
+			Summary:   sn.Summary,
+			Truncated: sn.Truncated,
+		})
+	}
+	if current, ok := t.nodes[session.CurrentID]; ok {
+		t.current = current
+	}
+	return t, nil
+}
+
+// toMessages converts contents to messages of the role
+func toMessages(role string, contents []string) []internal.Message {
+	messages := make([]internal.Message, 0, len(contents))
+	for _, content := range contents {
+		messages = append(messages, internal.Message{
+			Role:    role,
+			Content: content,
+		})
+	}
+	return messages
+}
+
+// messageContents returns contents of the messages
+func messageContents(messages []internal.Message) []string {
+	contents := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		contents = append(contents, msg.Content)
+	}
+	return contents
+}
@@ -0,0 +1,77 @@
+package application
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestChatService_LoadSession(t *testing.T) {
+	tests := []struct {
+		name string
+		// save saves the session explicitly, or only sends the text if false
+		save         bool
+		id           string
+		wantHistory  []internal.Message
+		wantMessages []internal.Message
+		wantErr      bool
+	}{
+		{
+			name:         "latest session",
+			save:         true,
+			id:           LatestSessionID,
+			wantHistory:  []internal.Message{user("Hello"), assistant("Hi!")},
+			wantMessages: []internal.Message{system("You are a bot"), user("Hello"), assistant("Hi!"), user("How are you?")},
+		},
+		{
+			name:    "unsaved session",
+			id:      LatestSessionID,
+			wantErr: true,
+		},
+		{
+			name:    "unknown session",
+			save:    true,
+			id:      "20230101-000000",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, 0, fakeopenai.Response{Content: "Hi!"}, fakeopenai.Response{Content: "Fine"})
+			store := internal.NewFileSessionStore(t.TempDir())
+			saved := newTestChatServiceWithStore(t, provider, store, ChatConfig{SystemMessages: []string{"You are a bot"}})
+			if err := saved.SendText(context.Background(), "Hello"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.save {
+				if err := saved.SaveSession(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := newTestChatServiceWithStore(t, provider, store, ChatConfig{})
+			err := s.LoadSession(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := historyMessages(s); !reflect.DeepEqual(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+
+			// The loaded conversation continues with its preamble
+			if err := s.SendText(context.Background(), "How are you?"); err != nil {
+				t.Fatal(err)
+			}
+			requests := srv.Requests()
+			if got := requestMessages(requests[len(requests)-1]); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("messages = %v, want %v", got, tt.wantMessages)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// Setting keys which can be changed with Set
+const (
+	settingModel            = "model"
+	settingTemperature      = "temperature"
+	settingTopP             = "topP"
+	settingMaxTokens        = "maxTokens"
+	settingPresencePenalty  = "presencePenalty"
+	settingFrequencyPenalty = "frequencyPenalty"
+	settingStream           = "stream"
+	settingSummarize        = "summarize"
+)
+
+// settingKeys are the keys in order of display
+var settingKeys = []string{
+	settingModel,
+	settingTemperature,
+	settingTopP,
+	settingMaxTokens,
+	settingPresencePenalty,
+	settingFrequencyPenalty,
+	settingStream,
+	settingSummarize,
+}
+
+// Reset clears the conversation and starts a new session
+// System messages and user messages are kept
+func (s *chatService) Reset() {
+	s.history = newHistoryTree()
+	s.session = nil
+}
+
+// SetSystemMessage replaces system messages with text
+func (s *chatService) SetSystemMessage(text string) {
+	s.SystemMessages = toMessages(internal.RoleSystem, []string{text})
+	s.autoSaveSession()
+}
+
+// AppendSystemMessage appends text to system messages
+func (s *chatService) AppendSystemMessage(text string) {
+	s.SystemMessages = append(s.SystemMessages, internal.Message{
+		Role:    internal.RoleSystem,
+		Content: text,
+	})
+	s.autoSaveSession()
+}
+
+// Reconfigure replaces the settings and the system and user messages with cfg
+// The conversation is kept, and the changes by Set and SetSystemMessage are overwritten
+func (s *chatService) Reconfigure(cfg ChatConfig) error {
+	if cfg.Params.Model != s.params.Model {
+		tokenizer, err := internal.NewTokenizer(cfg.Params.Model)
+		if err != nil {
+			return err
+		}
+		s.tokenizer = tokenizer
+	}
+	s.params = cfg.Params
+	s.summarize = cfg.Summarize
+	s.summaryPrompt = summaryPromptOrDefault(cfg.SummaryPrompt)
+	s.stream = cfg.Stream
+	s.SystemMessages = toMessages(internal.RoleSystem, cfg.SystemMessages)
+	s.UserMessages = toMessages(internal.RoleUser, cfg.UserMessages)
+	s.autoSaveSession()
+	return nil
+}
+
+// Set changes the setting of key to value
+// Parameters are validated in the same way as the config file, and nothing is changed if they are invalid
+func (s *chatService) Set(key, value string) error {
+	params := s.params
+	tokenizer := s.tokenizer
+	switch key {
+	case settingModel:
+		if err := internal.ValidateModel(value); err != nil {
+			return err
+		}
+		var err error
+		tokenizer, err = internal.NewTokenizer(value)
+		if err != nil {
+			return err
+		}
+		params.Model = value
+	case settingTemperature:
+		v, err := parseOptionalFloat(key, value)
+		if err != nil {
+			return err
+		}
+		params.Temperature = v
+	case settingTopP:
+		v, err := parseOptionalFloat(key, value)
+		if err != nil {
+			return err
+		}
+		params.TopP = v
+	case settingMaxTokens:
+		v, err := parseOptionalInt(key, value)
+		if err != nil {
+			return err
+		}
+		params.MaxTokens = v
+	case settingPresencePenalty:
+		v, err := parseOptionalFloat(key, value)
+		if err != nil {
+			return err
+		}
+		params.PresencePenalty = v
+	case settingFrequencyPenalty:
+		v, err := parseOptionalFloat(key, value)
+		if err != nil {
+			return err
+		}
+		params.FrequencyPenalty = v
+	case settingStream:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		s.stream = v
+	case settingSummarize:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		s.summarize = v
+	default:
+		return &ArgsError{Err: fmt.Errorf("unknown setting %q%s: must be one of %s", key, internal.DidYouMean(key, settingKeys), strings.Join(settingKeys, ", "))}
+	}
+
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	s.params = params
+	s.tokenizer = tokenizer
+	return nil
+}
+
+// ShowSettings prints the effective settings and system messages
+func (s *chatService) ShowSettings() {
+	values := map[string]string{
+		settingModel:            s.params.Model,
+		settingTemperature:      formatOptionalFloat(s.params.Temperature),
+		settingTopP:             formatOptionalFloat(s.params.TopP),
+		settingMaxTokens:        formatOptionalInt(s.params.MaxTokens),
+		settingPresencePenalty:  formatOptionalFloat(s.params.PresencePenalty),
+		settingFrequencyPenalty: formatOptionalFloat(s.params.FrequencyPenalty),
+		settingStream:           strconv.FormatBool(s.stream),
+		settingSummarize:        strconv.FormatBool(s.summarize),
+	}
+	for _, key := range settingKeys {
+		fmt.Printf("%-17s %s\n", key+":", values[key])
+	}
+	if len(s.params.Stop) > 0 {
+		fmt.Printf("%-17s %q\n", "stop:", s.params.Stop)
+	}
+
+	fmt.Println("systemMessages:")
+	for _, msg := range s.SystemMessages {
+		fmt.Printf("  - %s\n", msg.Content)
+	}
+	fmt.Println("userMessages:")
+	for _, msg := range s.UserMessages {
+		fmt.Printf("  - %s\n", msg.Content)
+	}
+}
+
+// parseOptionalFloat parses value of optional parameter
+// "default" unsets the parameter to use the provider default
+// NaN and infinities, which ParseFloat accepts, are rejected
+func parseOptionalFloat(key, value string) (*float32, error) {
+	if value == "default" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("%s must be a number or 'default'", key)
+	}
+	f := float32(v)
+	return &f, nil
+}
+
+// parseOptionalInt parses value of optional parameter where zero means unset
+// "default" unsets the parameter to use the provider default
+func parseOptionalInt(key, value string) (int, error) {
+	if value == "default" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer or 'default'", key)
+	}
+	return v, nil
+}
+
+// formatOptionalFloat formats value of optional parameter
+func formatOptionalFloat(v *float32) string {
+	if v == nil {
+		return "(default)"
+	}
+	return strconv.FormatFloat(float64(*v), 'g', -1, 32)
+}
+
+// formatOptionalInt formats value of optional parameter where zero means unset
+func formatOptionalInt(v int) string {
+	if v == 0 {
+		return "(default)"
+	}
+	return strconv.Itoa(v)
+}
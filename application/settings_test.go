@@ -0,0 +1,195 @@
+package application
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestChatService_Set(t *testing.T) {
+	tests := []struct {
+		name string
+		// temperature is the temperature of the chat config, or 1 if nil
+		temperature   *float32
+		key           string
+		value         string
+		wantParams    internal.ModelParams
+		wantStream    bool
+		wantSummarize bool
+		wantErr       bool
+	}{
+		{
+			name:       "model",
+			key:        settingModel,
+			value:      "gpt-4",
+			wantParams: internal.ModelParams{Model: "gpt-4", Temperature: float32Ptr(1)},
+			wantStream: true,
+		},
+		{
+			name:       "unknown model",
+			key:        settingModel,
+			value:      "gpt-5",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+		{
+			name:       "custom model",
+			key:        settingModel,
+			value:      "llama-2-13b-chat",
+			wantParams: internal.ModelParams{Model: "llama-2-13b-chat", Temperature: float32Ptr(1)},
+			wantStream: true,
+		},
+		{
+			name:        "model with invalid parameters",
+			temperature: float32Ptr(3),
+			key:         settingModel,
+			value:       "gpt-4",
+			wantParams:  internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(3)},
+			wantStream:  true,
+			wantErr:     true,
+		},
+		{
+			name:       "temperature",
+			key:        settingTemperature,
+			value:      "0.5",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(0.5)},
+			wantStream: true,
+		},
+		{
+			name:       "default temperature",
+			key:        settingTemperature,
+			value:      "default",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel},
+			wantStream: true,
+		},
+		{
+			name:       "temperature out of range",
+			key:        settingTemperature,
+			value:      "3",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+		{
+			name:       "NaN temperature",
+			key:        settingTemperature,
+			value:      "NaN",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+		{
+			name:       "infinite top p",
+			key:        settingTopP,
+			value:      "+Inf",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+		{
+			name:       "max tokens",
+			key:        settingMaxTokens,
+			value:      "256",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1), MaxTokens: 256},
+			wantStream: true,
+		},
+		{
+			name:       "max tokens is not a number",
+			key:        settingMaxTokens,
+			value:      "many",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+		{
+			name:          "summarize",
+			key:           settingSummarize,
+			value:         "true",
+			wantParams:    internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream:    true,
+			wantSummarize: true,
+		},
+		{
+			name:       "stream",
+			key:        settingStream,
+			value:      "false",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+		},
+		{
+			name:       "unknown setting",
+			key:        "seed",
+			value:      "1",
+			wantParams: internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(1)},
+			wantStream: true,
+			wantErr:    true,
+		},
+	}
+	internal.SetCustomModels(map[string]int{"llama-2-13b-chat": 4096})
+	t.Cleanup(func() {
+		internal.SetCustomModels(nil)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temperature := tt.temperature
+			if temperature == nil {
+				temperature = float32Ptr(1)
+			}
+			s := newTestChatService(t, nil, ChatConfig{
+				Params: internal.ModelParams{Temperature: temperature},
+				Stream: true,
+			})
+			tokenizer := s.tokenizer
+
+			err := s.Set(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && s.tokenizer != tokenizer {
+				t.Errorf("tokenizer is replaced on error")
+			}
+			if !reflect.DeepEqual(s.params, tt.wantParams) {
+				t.Errorf("params = %+v, want %+v", s.params, tt.wantParams)
+			}
+			if s.stream != tt.wantStream {
+				t.Errorf("stream = %v, want %v", s.stream, tt.wantStream)
+			}
+			if s.summarize != tt.wantSummarize {
+				t.Errorf("summarize = %v, want %v", s.summarize, tt.wantSummarize)
+			}
+		})
+	}
+}
+
+func TestChatService_Reconfigure(t *testing.T) {
+	srv, provider := newTestProvider(t, 0, fakeopenai.Response{Content: "Hi!"}, fakeopenai.Response{Content: "Fine"})
+	s := newTestChatService(t, provider, ChatConfig{SystemMessages: []string{"You are a bot"}})
+	if err := s.SendText(context.Background(), "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Reconfigure(ChatConfig{
+		Params:         internal.ModelParams{Model: "gpt-4"},
+		SystemMessages: []string{"You are a cat"},
+	})
+	if err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if err := s.SendText(context.Background(), "How are you?"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conversation is kept with the new settings
+	requests := srv.Requests()
+	last := requests[len(requests)-1]
+	if last.Model != "gpt-4" {
+		t.Errorf("model = %q, want %q", last.Model, "gpt-4")
+	}
+	want := []internal.Message{system("You are a cat"), user("Hello"), assistant("Hi!"), user("How are you?")}
+	if got := requestMessages(last); !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// lineRangePattern matches the file spec of lines, e.g. main.go:40-85 or main.go:40
+	lineRangePattern = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+	// declarationsPattern matches the file spec of declarations, e.g. main.go#Func1,Type.Method
+	declarationsPattern = regexp.MustCompile(`^(.+)#([^#]+)$`)
+)
+
+// CodeRegion is the code in the lines of the file
+type CodeRegion struct {
+	FileName string
+	// Name is the name of the declaration, or empty for lines
+	Name      string
+	StartLine int
+	EndLine   int
+	Code      string
+}
+
+// Label returns the file name and the line numbers of the region, e.g. main.go:40-85 (main) or main.go:12
+func (r CodeRegion) Label() string {
+	label := fmt.Sprintf("%s:%d-%d", r.FileName, r.StartLine, r.EndLine)
+	if r.StartLine == r.EndLine {
+		label = fmt.Sprintf("%s:%d", r.FileName, r.StartLine)
+	}
+	if r.Name != "" {
+		label += " (" + r.Name + ")"
+	}
+	return label
+}
+
+// fileSpec is the file argument of commands parsed into the files and their regions
+type fileSpec struct {
+	// pattern is the file name or the glob pattern
+	pattern string
+	// startLine and endLine are the lines to be extracted, or zero for the whole file
+	startLine, endLine int
+	// names are the declarations to be extracted
+	names []string
+}
+
+// parseFileSpec parses the file argument, which is followed by ':<start>-<end>' for lines or '#<name>,...' for declarations
+// The argument is taken as a file name as is if the file exists
+func parseFileSpec(spec string) (fileSpec, error) {
+	if _, err := os.Stat(spec); err == nil {
+		return fileSpec{pattern: spec}, nil
+	}
+
+	if m := lineRangePattern.FindStringSubmatch(spec); m != nil {
+		start, err := strconv.Atoi(m[2])
+		if err != nil {
+			return fileSpec{}, fmt.Errorf("invalid line %q", m[2])
+		}
+		end := start
+		if m[3] != "" {
+			end, err = strconv.Atoi(m[3])
+			if err != nil {
+				return fileSpec{}, fmt.Errorf("invalid line %q", m[3])
+			}
+		}
+		if start < 1 || end < start {
+			return fileSpec{}, fmt.Errorf("invalid line range %d-%d", start, end)
+		}
+		return fileSpec{pattern: m[1], startLine: start, endLine: end}, nil
+	}
+
+	if m := declarationsPattern.FindStringSubmatch(spec); m != nil {
+		names := []string{}
+		for _, name := range strings.Split(m[2], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fileSpec{}, fmt.Errorf("no declaration names in %q", spec)
+		}
+		return fileSpec{pattern: m[1], names: names}, nil
+	}
+
+	return fileSpec{pattern: spec}, nil
+}
+
+// files returns the files matching the pattern in order of names
+func (s fileSpec) files() ([]string, error) {
+	if !strings.ContainsAny(s.pattern, "*?[") {
+		if _, err := os.Stat(s.pattern); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("file not found: %s", s.pattern)
+			}
+			return nil, err
+		}
+		return []string{s.pattern}, nil
+	}
+
+	matches, err := filepath.Glob(s.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", s.pattern, err)
+	}
+	files := []string{}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %q", s.pattern)
+	}
+	return files, nil
+}
+
+// ReadCode reads the regions of the file argument and labels them with their file names and line numbers
+func ReadCode(spec string) (string, error) {
+	regions, err := readRegions(spec, "")
+	if err != nil {
+		return "", err
+	}
+	return formatRegions(regions), nil
+}
+
+// readRegions reads the regions of the file argument
+// If funcName is not empty, the declaration of the name is extracted from the files
+func readRegions(spec, funcName string) ([]CodeRegion, error) {
+	s, err := parseFileSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if funcName != "" {
+		if s.startLine > 0 || len(s.names) > 0 {
+			return nil, errors.New("function cannot be given with the lines or the declarations of the file")
+		}
+		s.names = []string{funcName}
+	}
+	fileNames, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	regions := []CodeRegion{}
+	found := map[string]bool{}
+	for _, fileName := range fileNames {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(s.names) > 0:
+			// Files of the pattern which do not declare the name are skipped
+			declRegions, err := extractDeclarations(fileName, content, s.names, found, len(fileNames) > 1)
+			if err != nil {
+				return nil, err
+			}
+			regions = append(regions, declRegions...)
+		default:
+			region, err := extractLines(fileName, string(content), s.startLine, s.endLine)
+			if err != nil {
+				return nil, err
+			}
+			regions = append(regions, region)
+		}
+	}
+
+	for _, name := range s.names {
+		if !found[name] {
+			return nil, fmt.Errorf("%w: %q in %s", errDeclarationNotFound, name, s.pattern)
+		}
+	}
+	return regions, nil
+}
+
+// extractLines extracts the lines of the file, or the whole file if start is zero
+// The end is limited to the last line
+func extractLines(fileName, content string, start, end int) (CodeRegion, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if start == 0 {
+		start, end = 1, len(lines)
+	}
+	if start > len(lines) {
+		return CodeRegion{}, fmt.Errorf("line %d is out of range: %s has %d lines", start, fileName, len(lines))
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return CodeRegion{
+		FileName:  fileName,
+		StartLine: start,
+		EndLine:   end,
+		Code:      strings.Join(lines[start-1:end], "\n"),
+	}, nil
+}
+
+// extractDeclarations extracts the declarations of the names in the Go file, marking the names found
+// If skipMissing is true, the names not declared in the file are ignored
+func extractDeclarations(fileName string, content []byte, names []string, found map[string]bool, skipMissing bool) ([]CodeRegion, error) {
+	if filepath.Ext(fileName) != ".go" {
+		return nil, fmt.Errorf("declarations can be extracted only from Go files: %s", fileName)
+	}
+	fset := token.NewFileSet()
+	decls, err := parseDeclarations(fset, fileName, content)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	regions := []CodeRegion{}
+	for _, name := range names {
+		decl, err := findDeclaration(fset, decls, name)
+		if errors.Is(err, errDeclarationNotFound) && skipMissing {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		found[name] = true
+
+		start := fset.Position(decl.start).Line
+		end := fset.Position(decl.end).Line
+		duplicate := false
+		for _, region := range regions {
+			duplicate = duplicate || region.StartLine == start
+		}
+		if duplicate {
+			continue
+		}
+		regions = append(regions, CodeRegion{
+			FileName:  fileName,
+			Name:      decl.name,
+			StartLine: start,
+			EndLine:   end,
+			Code:      strings.Join(lines[start-1:end], "\n"),
+		})
+	}
+	return regions, nil
+}
+
+// formatRegions joins the code of the regions labeled with their file names and line numbers
+func formatRegions(regions []CodeRegion) string {
+	blocks := make([]string, 0, len(regions))
+	for _, region := range regions {
+		blocks = append(blocks, region.Label()+"\n```\n"+region.Code+"\n```")
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,183 @@
+package application
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFileSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    fileSpec
+		wantErr bool
+	}{
+		{spec: "file.go", want: fileSpec{pattern: "file.go"}},
+		{spec: "file.go:40-85", want: fileSpec{pattern: "file.go", startLine: 40, endLine: 85}},
+		{spec: "file.go:12", want: fileSpec{pattern: "file.go", startLine: 12, endLine: 12}},
+		{spec: "dir/*.go:1-5", want: fileSpec{pattern: "dir/*.go", startLine: 1, endLine: 5}},
+		{spec: "file.go#A,B", want: fileSpec{pattern: "file.go", names: []string{"A", "B"}}},
+		{spec: "file.go#A, Type.Method ,", want: fileSpec{pattern: "file.go", names: []string{"A", "Type.Method"}}},
+		{spec: "*.go#(*T).M", want: fileSpec{pattern: "*.go", names: []string{"(*T).M"}}},
+		{spec: "file.go:0-5", wantErr: true},
+		{spec: "file.go:85-40", wantErr: true},
+		{spec: "file.go:99999999999999999999", wantErr: true},
+		{spec: "file.go#,", wantErr: true},
+		{spec: "file.go:abc", want: fileSpec{pattern: "file.go:abc"}},
+		// The existing file is taken as is even if it looks like a spec
+		{spec: "testdata/calc.go", want: fileSpec{pattern: "testdata/calc.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseFileSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFileSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFileSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRegions(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		funcName string
+		// wantLabels are the labels of the regions in order
+		wantLabels []string
+		// wantCode is the code of the first region if not empty
+		wantCode string
+		// wantErr is contained in the error message, or no error is expected if empty
+		wantErr string
+	}{
+		{
+			name:       "whole file",
+			spec:       "testdata/calc.go",
+			wantLabels: []string{"testdata/calc.go:1-11"},
+		},
+		{
+			name:       "lines",
+			spec:       "testdata/calc.go:9-11",
+			wantLabels: []string{"testdata/calc.go:9-11"},
+			wantCode:   "func Div(a, b int) int {\n\treturn a / b\n}",
+		},
+		{
+			name:       "single line",
+			spec:       "testdata/calc.go:10",
+			wantLabels: []string{"testdata/calc.go:10"},
+			wantCode:   "\treturn a / b",
+		},
+		{
+			name:       "end beyond the last line",
+			spec:       "testdata/calc.go:9-100",
+			wantLabels: []string{"testdata/calc.go:9-11"},
+		},
+		{
+			name:    "start beyond the last line",
+			spec:    "testdata/calc.go:12-20",
+			wantErr: "line 12 is out of range: testdata/calc.go has 11 lines",
+		},
+		{
+			name:       "declarations",
+			spec:       "testdata/calc.go#Div,Add",
+			wantLabels: []string{"testdata/calc.go:9-11 (Div)", "testdata/calc.go:4-6 (Add)"},
+			wantCode:   "func Div(a, b int) int {\n\treturn a / b\n}",
+		},
+		{
+			name:       "duplicate declarations",
+			spec:       "testdata/shapes.go#Rect.Area,(*Rect).Area",
+			wantLabels: []string{"testdata/shapes.go:56-58 (Rect.Area)"},
+		},
+		{
+			name:       "function",
+			spec:       "testdata/shapes.go",
+			funcName:   "Scale",
+			wantLabels: []string{"testdata/shapes.go:61-64 (Rect.Scale)"},
+		},
+		{
+			name:     "function with lines",
+			spec:     "testdata/calc.go:1-5",
+			funcName: "Add",
+			wantErr:  "function cannot be given with the lines or the declarations of the file",
+		},
+		{
+			name:       "glob",
+			spec:       "testdata/*.go",
+			wantLabels: []string{"testdata/calc.go:1-11", "testdata/shapes.go:1-78"},
+		},
+		{
+			name:       "glob with lines",
+			spec:       "testdata/*.go:1",
+			wantLabels: []string{"testdata/calc.go:1", "testdata/shapes.go:1"},
+		},
+		{
+			name:       "glob with declarations in different files",
+			spec:       "testdata/*.go#Total,Div",
+			wantLabels: []string{"testdata/calc.go:9-11 (Div)", "testdata/shapes.go:72-78 (Total)"},
+		},
+		{
+			name:    "glob with a declaration in no file",
+			spec:    "testdata/*.go#Mul",
+			wantErr: `declaration not found: "Mul" in testdata/*.go`,
+		},
+		{
+			name:    "glob with an ambiguous declaration",
+			spec:    "testdata/*.go#Area",
+			wantErr: `testdata/shapes.go: "Area" is ambiguous`,
+		},
+		{
+			// A glob which matches nothing is an error rather than sending no code
+			name:    "glob matching no files",
+			spec:    "testdata/*.rs",
+			wantErr: `no files match "testdata/*.rs"`,
+		},
+		{
+			name:    "file not found",
+			spec:    "testdata/missing.go#Add",
+			wantErr: "file not found: testdata/missing.go",
+		},
+		{
+			name:    "declaration not found",
+			spec:    "testdata/calc.go#Mul",
+			wantErr: `declaration not found: "Mul"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regions, err := readRegions(tt.spec, tt.funcName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readRegions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readRegions() error = %v", err)
+			}
+			labels := []string{}
+			for _, region := range regions {
+				labels = append(labels, region.Label())
+			}
+			if !reflect.DeepEqual(labels, tt.wantLabels) {
+				t.Errorf("labels = %q, want %q", labels, tt.wantLabels)
+			}
+			if tt.wantCode != "" && regions[0].Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", regions[0].Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestReadCode(t *testing.T) {
+	got, err := ReadCode("testdata/calc.go#Add,Div")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "testdata/calc.go:4-6 (Add)\n```\nfunc Add(a, b int) int {\n\treturn a + b\n}\n```\n\n" +
+		"testdata/calc.go:9-11 (Div)\n```\nfunc Div(a, b int) int {\n\treturn a / b\n}\n```"
+	if got != want {
+		t.Errorf("ReadCode() = %q, want %q", got, want)
+	}
+}
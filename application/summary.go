@@ -0,0 +1,145 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	summaryMessageHeader = `以下は、これまでの会話の要約と、それに続く会話です。
+	今後の会話で必要となるユーザーの情報、事実、決定事項を漏らさずに、全体を簡潔に要約してください。
+	要約のみを出力してください。
+	`
+	summarySystemMessageHeader = "これまでの会話の要約:"
+)
+
+// SummaryData is the variables available to the prompt template of summaries
+type SummaryData struct {
+	// Summary is the previous summary, or empty if nothing is summarized yet
+	Summary string
+	// Conversation is the messages to be summarized, each in "role: content" line
+	Conversation string
+	// Messages are the messages to be summarized
+	Messages []internal.Message
+}
+
+// defaultSummaryPrompt is the built-in prompt template of summaries
+var defaultSummaryPrompt = template.Must(ParseSummaryPrompt("summary",
+	summaryMessageHeader+"\n\n{{if .Summary}}"+summarySystemMessageHeader+"\n{{.Summary}}\n\n{{end}}{{.Conversation}}"))
+
+// ParseSummaryPrompt parses the prompt template of summaries
+// The template is executed with sample data so that unknown variables are reported before use
+func ParseSummaryPrompt(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := SummaryData{
+		Summary:      "summary",
+		Conversation: "user: message",
+		Messages:     []internal.Message{{Role: internal.RoleUser, Content: "message"}},
+	}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// summaryPromptOrDefault returns prompt, or the built-in prompt if prompt is nil
+func summaryPromptOrDefault(prompt *template.Template) *template.Template {
+	if prompt == nil {
+		return defaultSummaryPrompt
+	}
+	return prompt
+}
+
+// updateSummary merges the dropped histories into the summary of the active conversation
+// The summary is regenerated incrementally from the previous summary and set on the last dropped message
+func (s *chatService) updateSummary(ctx context.Context, dropped []*historyNode) error {
+	data := SummaryData{
+		Summary:  s.summary(),
+		Messages: make([]internal.Message, 0, len(dropped)),
+	}
+	lines := make([]string, 0, len(dropped))
+	for _, history := range dropped {
+		data.Messages = append(data.Messages, history.Message)
+		lines = append(lines, fmt.Sprintf("%s: %s", history.Role, history.Content))
+	}
+	data.Conversation = strings.Join(lines, "\n")
+
+	var b strings.Builder
+	if err := s.summaryPrompt.Execute(&b, data); err != nil {
+		return err
+	}
+	messageBody := b.String()
+
+	req := internal.ChatRequest{
+		ModelParams: s.params,
+		Messages: []internal.Message{
+			{
+				Role:    internal.RoleUser,
+				Content: messageBody,
+			},
+		},
+	}
+	response, err := s.provider.CreateChatCompletion(ctx, req)
+	if err != nil {
+		slog.Error("Error creating summary", err)
+		return err
+	}
+
+	summary := strings.TrimSpace(response.Message.Content)
+	if summary == "" {
+		return errors.New("empty summary")
+	}
+	dropped[len(dropped)-1].Summary = summary
+	return nil
+}
+
+// summaryNode returns the latest message of the active conversation which has the summary
+func (s *chatService) summaryNode() (*historyNode, bool) {
+	path := s.history.path()
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Summary != "" {
+			return path[i], true
+		}
+	}
+	return nil, false
+}
+
+// summary returns the summary of the active conversation, or empty string if nothing is summarized
+func (s *chatService) summary() string {
+	if node, ok := s.summaryNode(); ok {
+		return node.Summary
+	}
+	return ""
+}
+
+// summaryMessage returns the summary as a system message
+func (s *chatService) summaryMessage() (internal.Message, bool) {
+	summary := s.summary()
+	if summary == "" {
+		return internal.Message{}, false
+	}
+	return internal.Message{
+		Role:    internal.RoleSystem,
+		Content: fmt.Sprintf("%s\n%s", summarySystemMessageHeader, summary),
+	}, true
+}
+
+// ShowSummary prints the summary of the trimmed histories of the active conversation
+func (s *chatService) ShowSummary() {
+	summary := s.summary()
+	if summary == "" {
+		fmt.Println("No summary yet")
+		return
+	}
+	fmt.Println(summary)
+}
@@ -0,0 +1,101 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"text/template"
+
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestParseSummaryPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{name: "variables", text: "{{.Summary}}{{.Conversation}}{{range .Messages}}{{.Role}}{{.Content}}{{end}}"},
+		{name: "unknown variable", text: "{{.Code}}", wantErr: true},
+		{name: "syntax error", text: "{{.Summary", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSummaryPrompt("summary", tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSummaryPrompt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChatService_updateSummary(t *testing.T) {
+	custom := template.Must(ParseSummaryPrompt("summary",
+		"Summarize in English.\n{{if .Summary}}Previous: {{.Summary}}\n{{end}}{{range .Messages}}[{{.Role}}] {{.Content}}\n{{end}}"))
+	tests := []struct {
+		name     string
+		prompt   *template.Template
+		previous string
+		// want is the content of the request to summarize
+		want string
+	}{
+		{
+			name: "built-in prompt",
+			want: summaryMessageHeader + "\n\nuser: Hello\nassistant: Hi!",
+		},
+		{
+			name:     "built-in prompt with previous summary",
+			previous: "Greeted",
+			want:     summaryMessageHeader + "\n\n" + summarySystemMessageHeader + "\nGreeted\n\nuser: Hello\nassistant: Hi!",
+		},
+		{
+			name:     "custom prompt",
+			prompt:   custom,
+			previous: "Greeted",
+			want:     "Summarize in English.\nPrevious: Greeted\n[user] Hello\n[assistant] Hi!\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, 0, fakeopenai.Response{Content: " Summary "})
+			s := newTestChatService(t, provider, ChatConfig{SummaryPrompt: tt.prompt})
+			if tt.previous != "" {
+				s.history.add(system("Earlier")).Summary = tt.previous
+			}
+			dropped := []*historyNode{s.history.add(user("Hello")), s.history.add(assistant("Hi!"))}
+
+			if err := s.updateSummary(context.Background(), dropped); err != nil {
+				t.Fatalf("updateSummary() error = %v", err)
+			}
+			requests := srv.Requests()
+			if len(requests) != 1 || len(requests[0].Messages) != 1 {
+				t.Fatalf("requests = %+v, want a single message", requests)
+			}
+			if got := requests[0].Messages[0].Content; got != tt.want {
+				t.Errorf("request = %q, want %q", got, tt.want)
+			}
+			if got := dropped[1].Summary; got != "Summary" {
+				t.Errorf("Summary = %q, want %q", got, "Summary")
+			}
+		})
+	}
+}
+
+func TestChatService_Reconfigure_summaryPrompt(t *testing.T) {
+	s := newTestChatService(t, nil, ChatConfig{})
+	if s.summaryPrompt != defaultSummaryPrompt {
+		t.Fatal("summaryPrompt is not the built-in one")
+	}
+	custom := template.Must(ParseSummaryPrompt("summary", "{{.Conversation}}"))
+	if err := s.Reconfigure(ChatConfig{Params: s.params, SummaryPrompt: custom}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if s.summaryPrompt != custom {
+		t.Error("summaryPrompt is not replaced")
+	}
+	if err := s.Reconfigure(ChatConfig{Params: s.params}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if s.summaryPrompt != defaultSummaryPrompt {
+		t.Error("summaryPrompt is not restored to the built-in one")
+	}
+}
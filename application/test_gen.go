@@ -5,24 +5,34 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strings"
+	"text/template"
 
-	"github.com/sashabaranov/go-openai"
 	"github.com/sota0121/go-ai-chat/internal"
-	"golang.org/x/exp/slog"
 )
 
 type TestGenService interface {
-	SendRequest(ctx context.Context, text string) error
-	SendRequestStream(ctx context.Context, text string) error
+	SendRequest(ctx context.Context, req CodeRequest) error
+	SendRequestStream(ctx context.Context, req CodeRequest) error
+	GenerateTest(ctx context.Context, req CodeRequest, w io.Writer) error
 }
 
-func NewTestGenService() TestGenService {
-	return &testGenService{}
+// NewTestGenService creates TestGenService
+// The built-in prompt is used if prompt is nil
+func NewTestGenService(provider internal.Provider, params internal.ModelParams, prompt *template.Template) TestGenService {
+	if prompt == nil {
+		prompt = defaultTestGenPrompt
+	}
+	return &testGenService{
+		provider: provider,
+		params:   params,
+		prompt:   prompt,
+	}
 }
 
 type testGenService struct {
+	provider internal.Provider
+	params   internal.ModelParams
+	prompt   *template.Template
 }
 
 var _ TestGenService = (*testGenService)(nil)
@@ -30,163 +40,100 @@ var _ TestGenService = (*testGenService)(nil)
 const (
 	tesgGenMessageHeader = `以下のプログラムについて、テストコードを生成してください。
 	テスト対象の関数の正常系と異常系のテストコードを生成してください。
-	テストコード生成には、 gomock を使用してください。
-	テストコードの形式は、AAA(Arrange, Act, Assert) に従ってください。
+	{{if not .Framework}}テストコード生成には、 gomock を使用してください。
+	{{end}}テストコードの形式は、AAA(Arrange, Act, Assert) に従ってください。
 	`
+	// testGenFrameworkMessage asks to use the framework given by --framework instead of gomock
+	testGenFrameworkMessage = "{{if .Framework}}テストフレームワークには、 {{.Framework}} を使用してください。\n{{end}}"
 )
 
-// SendRequest sends request to OpenAI to generate test code
-// This expects text to be in the following format:
-// :testgen <file> or :testgen <file> <function>
-func (s *testGenService) SendRequest(ctx context.Context, text string) error {
-	// Parse input text
-	fileName, funcName, err := s.parseInput(text)
-	if err != nil {
-		return err
-	}
-
-	// Read file
-	file, err := os.Open(fileName)
+// SendRequest sends request to the provider to generate test code
+// If the function name of req is empty, the whole file is sent
+func (s *testGenService) SendRequest(ctx context.Context, req CodeRequest) error {
+	chatReq, err := s.newRequest(req)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.New("file not found")
-		}
 		return err
 	}
 
-	// Get program code
-	code, err := extractCode(file, funcName)
+	// Send request to the provider
+	response, err := s.provider.CreateChatCompletion(ctx, chatReq)
 	if err != nil {
-		slog.Error("Error extracting code", err)
 		return err
 	}
 
-	// Make message body
-	messageBody := fmt.Sprintf("%s\n\n%s", tesgGenMessageHeader, code)
-
-	// Get OpenAI client from context
-	openaiClient := internal.GetOpenAIClientFromContext(ctx)
+	// Print response
+	fmt.Printf("AI> %v\n", response.Message.Content)
+	return nil
+}
 
-	// Send request to OpenAI
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: messageBody,
-			},
-		},
-	}
-	response, err := openaiClient.CreateChatCompletion(ctx, req)
+// SendRequestStream sends request to the provider to generate test code in stream
+// If the function name of req is empty, the whole file is sent
+func (s *testGenService) SendRequestStream(ctx context.Context, req CodeRequest) error {
+	chatReq, err := s.newRequest(req)
 	if err != nil {
-		slog.Error("Error creating chat completion", err)
 		return err
 	}
 
-	// Print response
-	if len(response.Choices) == 0 {
-		slog.Error("Error creating chat completion", errors.New("no choices"))
-		return errors.New("no choices")
+	stream, err := s.provider.CreateChatCompletionStream(ctx, chatReq)
+	if err == nil {
+		defer stream.Close()
 	}
-	fmt.Printf("AI> %v\n", response.Choices[0].Message.Content)
-	return nil
-}
-
-// checkInput checks if text is in the correct format
-func (s *testGenService) checkInput(text string) error {
-	if !strings.HasPrefix(text, ":testgen") {
-		return errors.New("invalid format: text must start with ':testgen'")
+	if isCanceled(ctx) {
+		fmt.Println("(canceled)")
+		return nil
 	}
-	tokens := strings.Split(text, " ")
-	if len(tokens) < 2 {
-		return errors.New("invalid format: text must contain a file name or a file name and a function name")
+	if err != nil {
+		return err
 	}
-	return nil
-}
 
-// parseInput parses text
-func (s *testGenService) parseInput(text string) (string, string, error) {
-	// Check if text is in the correct format
-	if err := s.checkInput(text); err != nil {
-		return "", "", err
-	}
+	fmt.Printf("AI> ")
+	for {
+		token, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			fmt.Printf("\n\n")
+			return nil
+		}
+		if isCanceled(ctx) {
+			fmt.Printf("\n(canceled)\n\n")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	// Parse text
-	tokens := strings.Split(text, " ")
-	fileName := tokens[1]
-	funcName := ""
-	if len(tokens) > 2 {
-		funcName = tokens[2]
+		fmt.Printf("%v", token)
 	}
-	return fileName, funcName, nil
 }
 
-// SendRequestStream sends request to OpenAI to generate test code in stream
-// This expects text to be in the following format:
-// :testgen <file> or :testgen <file> <function>
-func (s *testGenService) SendRequestStream(ctx context.Context, text string) error {
-	// Parse input text
-	fileName, funcName, err := s.parseInput(text)
+// GenerateTest generates test code for the function of the file, or the whole file if funcName is empty
+// The answer is written to w in stream without any decoration
+func (s *testGenService) GenerateTest(ctx context.Context, req CodeRequest, w io.Writer) error {
+	chatReq, err := s.newRequest(req)
 	if err != nil {
 		return err
 	}
+	return writeStream(ctx, s.provider, chatReq, w)
+}
 
-	// Read file
-	file, err := os.Open(fileName)
+// newRequest makes the request with the code of the function in the file
+// If the function name is empty, the whole file is used
+func (s *testGenService) newRequest(req CodeRequest) (internal.ChatRequest, error) {
+	params, err := requestParams(s.params, req)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.New("file not found")
-		}
-		return err
+		return internal.ChatRequest{}, err
 	}
-
-	// Get program code
-	code, err := extractCode(file, funcName)
+	messageBody, err := renderPrompt(s.prompt, req)
 	if err != nil {
-		slog.Error("Error extracting code", err)
-		return err
+		return internal.ChatRequest{}, err
 	}
 
-	// Make message body
-	messageBody := fmt.Sprintf("%s\n\n%s", tesgGenMessageHeader, code)
-
-	// Get OpenAI client from context
-	openaiClient := internal.GetOpenAIClientFromContext(ctx)
-
-	// Send request to OpenAI in stream
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
+	return internal.ChatRequest{
+		ModelParams: params,
+		Messages: []internal.Message{
 			{
-				Role:    openai.ChatMessageRoleUser,
+				Role:    internal.RoleUser,
 				Content: messageBody,
 			},
 		},
-		Stream: true,
-	}
-
-	stream, err := openaiClient.CreateChatCompletionStream(ctx, req)
-	if err != nil {
-		slog.Error("Error creating chat completion stream", err)
-		return err
-	}
-	defer stream.Close()
-
-	fmt.Printf("AI> ")
-	for {
-		response, err := stream.Recv()
-		if errors.Is(err, io.EOF) {
-			fmt.Printf("\n\n")
-			return nil
-		}
-		if err != nil {
-			slog.Error("Error receiving chat completion stream", err)
-			return err
-		}
-
-		if len(response.Choices) == 0 {
-			continue
-		}
-		fmt.Printf("%v", response.Choices[0].Delta.Content)
-	}
+	}, nil
 }
@@ -0,0 +1,159 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+func TestTestGenService(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileName  string
+		funcName  string
+		framework string
+		// stream generates the test by GenerateTest, or by SendRequest if false
+		stream      bool
+		maxAttempts int
+		responses   []fakeopenai.Response
+		// wantRequests is the number of requests received by the server
+		wantRequests int
+		wantContains []string
+		wantExcludes []string
+		wantOutput   string
+		wantErr      bool
+	}{
+		{
+			name:         "function in stream",
+			fileName:     "testdata/calc.go",
+			funcName:     "Div",
+			stream:       true,
+			responses:    []fakeopenai.Response{{Tokens: []string{"func TestDiv", "(t *testing.T) {}"}}},
+			wantRequests: 1,
+			wantContains: []string{"gomock", "AAA", "func Div(a, b int) int {"},
+			wantExcludes: []string{"func Add", "テストフレームワーク"},
+			wantOutput:   "func TestDiv(t *testing.T) {}\n",
+		},
+		{
+			name:         "whole file without stream",
+			fileName:     "testdata/calc.go",
+			responses:    []fakeopenai.Response{{Content: "func TestCalc(t *testing.T) {}"}},
+			wantRequests: 1,
+			wantContains: []string{"gomock", "func Add(a, b int) int {", "func Div(a, b int) int {"},
+		},
+		{
+			name:         "server error",
+			fileName:     "testdata/calc.go",
+			funcName:     "Div",
+			responses:    []fakeopenai.Response{{Content: "bad gateway", StatusCode: http.StatusBadGateway}},
+			wantRequests: 1,
+			wantContains: []string{"gomock", "func Div(a, b int) int {"},
+			wantErr:      true,
+		},
+		{
+			name:        "server error is retried",
+			fileName:    "testdata/calc.go",
+			funcName:    "Div",
+			maxAttempts: 2,
+			responses: []fakeopenai.Response{
+				{Content: "bad gateway", StatusCode: http.StatusBadGateway},
+				{Content: "func TestDiv(t *testing.T) {}"},
+			},
+			wantRequests: 2,
+			wantContains: []string{"gomock", "func Div(a, b int) int {"},
+		},
+		{
+			name:         "framework",
+			fileName:     "testdata/calc.go",
+			funcName:     "Add",
+			framework:    "testify",
+			stream:       true,
+			responses:    []fakeopenai.Response{{Content: "func TestAdd(t *testing.T) {}"}},
+			wantRequests: 1,
+			wantContains: []string{"testify", "func Add(a, b int) int {"},
+			wantExcludes: []string{"gomock"},
+			wantOutput:   "func TestAdd(t *testing.T) {}\n",
+		},
+		{
+			name:         "unknown function",
+			fileName:     "testdata/calc.go",
+			funcName:     "Mul",
+			stream:       true,
+			wantRequests: 0,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, provider := newTestProvider(t, tt.maxAttempts, tt.responses...)
+			s := NewTestGenService(provider, internal.ModelParams{Model: internal.DefaultModel}, nil)
+
+			var out bytes.Buffer
+			req := CodeRequest{FileName: tt.fileName, FuncName: tt.funcName, Framework: tt.framework}
+			var err error
+			if tt.stream {
+				err = s.GenerateTest(context.Background(), req, &out)
+			} else {
+				err = s.SendRequest(context.Background(), req)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			requests := srv.Requests()
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			if tt.wantRequests == 0 {
+				return
+			}
+			last := requests[len(requests)-1]
+			if last.Stream != tt.stream {
+				t.Errorf("stream = %v, want %v", last.Stream, tt.stream)
+			}
+			messages := requestMessages(last)
+			if len(messages) != 1 || messages[0].Role != internal.RoleUser {
+				t.Fatalf("messages = %q, want a user message", messages)
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(messages[0].Content, s) {
+					t.Errorf("prompt does not contain %q:\n%s", s, messages[0].Content)
+				}
+			}
+			for _, s := range tt.wantExcludes {
+				if strings.Contains(messages[0].Content, s) {
+					t.Errorf("prompt contains %q:\n%s", s, messages[0].Content)
+				}
+			}
+			if tt.stream && out.String() != tt.wantOutput {
+				t.Errorf("output = %q, want %q", out.String(), tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestTestGenService_zeroTemperature(t *testing.T) {
+	srv, provider := newTestProvider(t, 0, fakeopenai.Response{Content: "func TestDiv(t *testing.T) {}"})
+	// testgen uses temperature 0 in the built-in config
+	s := NewTestGenService(provider, internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(0)}, nil)
+
+	if err := s.SendRequest(context.Background(), CodeRequest{FileName: "testdata/calc.go", FuncName: "Div"}); err != nil {
+		t.Fatalf("SendRequest() error = %v", err)
+	}
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(requests))
+	}
+	// Zero is omitted from the request, which makes the API use its default temperature
+	if got := requests[0].Temperature; got <= 0 || got > 1e-30 {
+		t.Errorf("temperature = %g, want a near-zero positive value", got)
+	}
+	if got := requests[0].TopP; got != 0 {
+		t.Errorf("top p = %g, want omitted", got)
+	}
+}
@@ -0,0 +1,11 @@
+package calc
+
+// Add returns the sum of a and b
+func Add(a, b int) int {
+	return a + b
+}
+
+// Div returns the quotient of a and b
+func Div(a, b int) int {
+	return a / b
+}
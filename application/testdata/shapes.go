@@ -0,0 +1,78 @@
+package shapes
+
+import "math"
+
+// Shape is a figure which has an area
+type Shape interface {
+	Area() float64
+}
+
+// Kind is the kind of shapes
+type Kind int
+
+const (
+	KindCircle Kind = iota
+	KindRect
+)
+
+const Pi = math.Pi
+
+var (
+	// Unit is the circle of radius 1
+	Unit   = Circle{R: 1}
+	_      = Rect{}
+	Origin = Point{}
+)
+
+var Default Shape = Unit
+
+type (
+	// Point is a position on the plane
+	Point struct {
+		X, Y float64
+	}
+	// Pair is a pair of values
+	Pair[T any] struct {
+		First, Second T
+	}
+)
+
+// Circle is a circle of radius R
+type Circle struct {
+	R float64
+}
+
+// Area returns the area of the circle
+func (c Circle) Area() float64 {
+	return Pi * c.R * c.R
+}
+
+// Rect is a rectangle of width W and height H
+type Rect struct {
+	W, H float64
+}
+
+// Area returns the area of the rectangle
+func (r *Rect) Area() float64 {
+	return r.W * r.H
+}
+
+// Scale scales the rectangle
+func (r *Rect) Scale(f float64) {
+	r.W *= f
+	r.H *= f
+}
+
+// Swap swaps the values
+func (p Pair[T]) Swap() Pair[T] {
+	return Pair[T]{First: p.Second, Second: p.First}
+}
+
+// Total returns the sum of the areas
+func Total(shapes ...Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"sort"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// historyNode is a message in the conversation tree
+type historyNode struct {
+	internal.Message
+	ID     int
+	Pinned bool
+	// Summary is set on the last message merged into the summary
+	// The summary covers the messages on the path up to this message except for pinned ones,
+	// so that each branch has the summary of its own messages
+	Summary string
+	// Truncated is set when the answer is canceled while receiving it
+	Truncated bool
+	parent    *historyNode
+	children  []*historyNode
+}
+
+// historyTree is the conversation modeled as a tree
+// Editing or regenerating a message forks a new branch from its parent,
+// and the path from the root to current is the active conversation
+type historyTree struct {
+	root    *historyNode
+	current *historyNode
+	nodes   map[int]*historyNode
+	lastID  int
+}
+
+func newHistoryTree() *historyTree {
+	root := &historyNode{}
+	return &historyTree{
+		root:    root,
+		current: root,
+		nodes:   map[int]*historyNode{},
+	}
+}
+
+// add adds the message as a child of current and moves current to it
+func (t *historyTree) add(msg internal.Message) *historyNode {
+	t.lastID++
+	node := &historyNode{
+		Message: msg,
+		ID:      t.lastID,
+	}
+	t.attach(t.current, node)
+	t.current = node
+	return node
+}
+
+// attach attaches the node as the last child of parent
+func (t *historyTree) attach(parent, node *historyNode) {
+	node.parent = parent
+	parent.children = append(parent.children, node)
+	t.nodes[node.ID] = node
+	if node.ID > t.lastID {
+		t.lastID = node.ID
+	}
+}
+
+// remove removes the node and its descendants
+// If current is removed, current moves to the parent of the node
+func (t *historyTree) remove(node *historyNode) {
+	for n := t.current; n != nil; n = n.parent {
+		if n == node {
+			t.current = node.parent
+			break
+		}
+	}
+
+	siblings := node.parent.children
+	for i, sibling := range siblings {
+		if sibling == node {
+			node.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	t.walk(node, func(n *historyNode, _ int) {
+		delete(t.nodes, n.ID)
+	})
+}
+
+// prune removes the active conversation from the node to current and moves current to the parent of the node
+// The nodes which other branches fork from are kept
+func (t *historyTree) prune(node *historyNode) {
+	parent := node.parent
+	for n := t.current; n != parent; {
+		next := n.parent
+		if len(n.children) == 0 {
+			t.remove(n)
+		}
+		n = next
+	}
+	t.current = parent
+}
+
+// path returns the active conversation from the oldest message to current
+func (t *historyTree) path() []*historyNode {
+	path := []*historyNode{}
+	for n := t.current; n != t.root; n = n.parent {
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// leaves returns the tips of the branches in order of creation
+func (t *historyTree) leaves() []*historyNode {
+	leaves := []*historyNode{}
+	t.walk(t.root, func(n *historyNode, _ int) {
+		if n != t.root && len(n.children) == 0 {
+			leaves = append(leaves, n)
+		}
+	})
+	sort.Slice(leaves, func(i, j int) bool {
+		return leaves[i].ID < leaves[j].ID
+	})
+	return leaves
+}
+
+// latestLeaf returns the most recently created leaf under the node
+func (t *historyTree) latestLeaf(node *historyNode) *historyNode {
+	latest := node
+	t.walk(node, func(n *historyNode, _ int) {
+		if len(n.children) == 0 && n.ID > latest.ID {
+			latest = n
+		}
+	})
+	return latest
+}
+
+// isActive returns true if the node is on the active conversation
+func (t *historyTree) isActive(node *historyNode) bool {
+	for n := t.current; n != nil; n = n.parent {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// walk visits the node and its descendants in depth first order
+func (t *historyTree) walk(node *historyNode, fn func(n *historyNode, depth int)) {
+	var visit func(n *historyNode, depth int)
+	visit = func(n *historyNode, depth int) {
+		fn(n, depth)
+		for _, child := range n.children {
+			visit(child, depth+1)
+		}
+	}
+	visit(node, 0)
+}
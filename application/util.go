@@ -1,65 +1,193 @@
 package application
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"io"
 	"os"
 	"strings"
 
-	"golang.org/x/exp/slog"
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slices"
 )
 
-// extractCode extracts code from file
-// This uses AST if a function name is provided
-// Otherwise, this reads the whole file
-func extractCode(file *os.File, funcName string) (string, error) {
-	// Read the whole file
-	if funcName == "" {
-		return getFileContent(file)
-	}
+// errDeclarationNotFound is returned when the file has no declaration of the name
+var errDeclarationNotFound = errors.New("declaration not found")
+
+// declaration is a top-level declaration which can be extracted by its name
+type declaration struct {
+	// name is the name of the declaration, or 'Type.Method' for methods
+	name string
+	// method is the method name without the receiver type, or empty for the other declarations
+	method     string
+	start, end token.Pos
+}
 
-	// Parse file and extract the target function
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, file.Name(), nil, parser.ParseComments)
+// parseDeclarations returns the functions, methods, types, constants and variables declared in the file
+// Declarations in a group are extracted with the whole group, which keeps the keyword and the iota of constants
+func parseDeclarations(fset *token.FileSet, fileName string, src []byte) ([]declaration, error) {
+	f, err := parser.ParseFile(fset, fileName, src, parser.SkipObjectResolution)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	decls := []declaration{}
 	for _, decl := range f.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok {
-			if fn.Name.Name == funcName {
-				// Get where the function starts and ends
-				start := fset.Position(fn.Pos()).Line
-				end := fset.Position(fn.End()).Line
-
-				// Get the content of the file
-				content, err := getFileContent(file)
-				if err != nil {
-					slog.Error("Error getting file content", err)
-					return "", err
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				decls = append(decls, declaration{name: d.Name.Name, start: d.Pos(), end: d.End()})
+				continue
+			}
+			decls = append(decls, declaration{
+				name:   receiverType(d.Recv.List[0].Type) + "." + d.Name.Name,
+				method: d.Name.Name,
+				start:  d.Pos(),
+				end:    d.End(),
+			})
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				for _, name := range specNames(spec) {
+					if name != "_" {
+						decls = append(decls, declaration{name: name, start: d.Pos(), end: d.End()})
+					}
 				}
+			}
+		}
+	}
+	return decls, nil
+}
 
-				// Extract the target function
-				lines := strings.Split(content, "\n")
-				return strings.Join(lines[start-1:end], "\n"), nil
+// findDeclaration finds the declaration of the name, which is 'Name' or 'Type.Method'
+// A name without the type matches the other declarations first and then methods
+// If the name matches multiple methods, the error lists them as candidates
+func findDeclaration(fset *token.FileSet, decls []declaration, name string) (declaration, error) {
+	// Receivers can be written as in Go, e.g. (*Type).Method
+	name = strings.NewReplacer("(", "", ")", "", "*", "").Replace(name)
+
+	matches := []declaration{}
+	for _, decl := range decls {
+		if decl.name == name {
+			matches = append(matches, decl)
+		}
+	}
+	if len(matches) == 0 && !strings.Contains(name, ".") {
+		for _, decl := range decls {
+			if decl.method == name {
+				matches = append(matches, decl)
 			}
 		}
 	}
-	err = errors.New("function not found")
-	return "", err
+
+	switch len(matches) {
+	case 0:
+		names := make([]string, 0, len(decls))
+		for _, decl := range decls {
+			names = append(names, decl.name)
+		}
+		return declaration{}, fmt.Errorf("%w: %q%s", errDeclarationNotFound, name, internal.DidYouMean(name, names))
+	case 1:
+		return matches[0], nil
+	default:
+		candidates := make([]string, 0, len(matches))
+		for _, decl := range matches {
+			candidates = append(candidates, fmt.Sprintf("%s (line %d)", decl.name, fset.Position(decl.start).Line))
+		}
+		return declaration{}, fmt.Errorf("%q is ambiguous, specify one of: %s", name, strings.Join(candidates, ", "))
+	}
+}
+
+// receiverType returns the type name of the receiver without '*' and type parameters
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.ParenExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	default:
+		return ""
+	}
+}
+
+// specNames returns the names declared by the spec
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		names := make([]string, 0, len(s.Names))
+		for _, name := range s.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	default:
+		return nil
+	}
 }
 
-// getFileContent returns the content of the file
-func getFileContent(file *os.File) (string, error) {
-	fi, err := file.Stat()
+// listDeclarations returns the names of the declarations in the file for completion
+// Methods are listed by their names if they are unique, or as 'Type.Method' otherwise
+func listDeclarations(fileName string) ([]string, error) {
+	src, err := os.ReadFile(fileName)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	data := make([]byte, fi.Size())
-	_, err = file.Read(data)
+	decls, err := parseDeclarations(token.NewFileSet(), fileName, src)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, decl := range decls {
+		if decl.method == "" {
+			counts[decl.name]++
+		} else {
+			counts[decl.method]++
+		}
+	}
+	names := []string{}
+	for _, decl := range decls {
+		if decl.method != "" && counts[decl.method] == 1 {
+			names = append(names, decl.method)
+			continue
+		}
+		if !slices.Contains(names, decl.name) {
+			names = append(names, decl.name)
+		}
+	}
+	return names, nil
+}
+
+// writeStream sends the request in stream and writes the answer to w without any decoration
+func writeStream(ctx context.Context, provider internal.Provider, req internal.ChatRequest, w io.Writer) error {
+	stream, err := provider.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for {
+		token, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			_, err = fmt.Fprintln(w)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprint(w, token); err != nil {
+			return err
+		}
 	}
-	return string(data), nil
 }
@@ -0,0 +1,143 @@
+package application
+
+import (
+	"errors"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindDeclaration(t *testing.T) {
+	src, err := os.ReadFile("testdata/shapes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	decls, err := parseDeclarations(fset, "testdata/shapes.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// want is the source code of the declaration
+		want string
+		// wantErr is contained in the error message, or no error is expected if empty
+		wantErr string
+	}{
+		{
+			name: "Total",
+			want: "func Total(shapes ...Shape) float64 {\n\ttotal := 0.0\n\tfor _, s := range shapes {\n\t\ttotal += s.Area()\n\t}\n\treturn total\n}",
+		},
+		{
+			name: "Circle.Area",
+			want: "func (c Circle) Area() float64 {\n\treturn Pi * c.R * c.R\n}",
+		},
+		{
+			name: "Rect.Area",
+			want: "func (r *Rect) Area() float64 {\n\treturn r.W * r.H\n}",
+		},
+		{
+			name: "(*Rect).Area",
+			want: "func (r *Rect) Area() float64 {\n\treturn r.W * r.H\n}",
+		},
+		{
+			name: "Scale",
+			want: "func (r *Rect) Scale(f float64) {\n\tr.W *= f\n\tr.H *= f\n}",
+		},
+		{
+			name: "Pair.Swap",
+			want: "func (p Pair[T]) Swap() Pair[T] {\n\treturn Pair[T]{First: p.Second, Second: p.First}\n}",
+		},
+		{
+			name: "Circle",
+			want: "type Circle struct {\n\tR float64\n}",
+		},
+		{
+			name: "Shape",
+			want: "type Shape interface {\n\tArea() float64\n}",
+		},
+		{
+			name: "Point",
+			want: "type (\n\t// Point is a position on the plane\n\tPoint struct {\n\t\tX, Y float64\n\t}\n\t// Pair is a pair of values\n\tPair[T any] struct {\n\t\tFirst, Second T\n\t}\n)",
+		},
+		{
+			name: "Pair",
+			want: "type (\n\t// Point is a position on the plane\n\tPoint struct {\n\t\tX, Y float64\n\t}\n\t// Pair is a pair of values\n\tPair[T any] struct {\n\t\tFirst, Second T\n\t}\n)",
+		},
+		{
+			name: "KindRect",
+			want: "const (\n\tKindCircle Kind = iota\n\tKindRect\n)",
+		},
+		{
+			name: "Pi",
+			want: "const Pi = math.Pi",
+		},
+		{
+			name: "Origin",
+			want: "var (\n\t// Unit is the circle of radius 1\n\tUnit   = Circle{R: 1}\n\t_      = Rect{}\n\tOrigin = Point{}\n)",
+		},
+		{
+			name: "Default",
+			want: "var Default Shape = Unit",
+		},
+		{
+			name:    "Area",
+			wantErr: `"Area" is ambiguous, specify one of: Circle.Area (line 46), Rect.Area (line 56)`,
+		},
+		{
+			name:    "Square.Area",
+			wantErr: `declaration not found: "Square.Area"`,
+		},
+		{
+			name:    "Totl",
+			wantErr: `declaration not found: "Totl" (did you mean "Total"?)`,
+		},
+		{
+			name:    "_",
+			wantErr: "declaration not found",
+		},
+		{
+			name:    "math",
+			wantErr: "declaration not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decl, err := findDeclaration(fset, decls, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("findDeclaration() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findDeclaration() error = %v", err)
+			}
+			got := string(src[fset.Position(decl.start).Offset:fset.Position(decl.end).Offset])
+			if got != tt.want {
+				t.Errorf("findDeclaration() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := findDeclaration(fset, decls, "Totl"); !errors.Is(err, errDeclarationNotFound) {
+		t.Errorf("findDeclaration() error = %v, want %v", err, errDeclarationNotFound)
+	}
+}
+
+func TestListDeclarations(t *testing.T) {
+	got, err := listDeclarations("testdata/shapes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Shape", "Kind", "KindCircle", "KindRect", "Pi", "Unit", "Origin", "Default", "Point", "Pair",
+		"Circle", "Circle.Area", "Rect", "Rect.Area", "Scale", "Swap", "Total",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listDeclarations() = %q, want %q", got, want)
+	}
+}
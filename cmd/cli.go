@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sota0121/go-ai-chat/application"
+	"github.com/sota0121/go-ai-chat/internal"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// options are the global flags
+type options struct {
+	configFile   string
+	envFile      string
+	model        string
+	profile      string
+	persona      string
+	noStream     bool
+	outputFormat string
+}
+
+// newRootCommand creates the command line interface
+// Running without subcommand starts a chat
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	resume := ""
+
+	root := &cobra.Command{
+		Use:          "gochat",
+		Short:        "Chat with AI and let it find bugs and generate tests for your code",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd.Context(), opts, resume)
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.configFile, "config", "", "config file applied over the user and project config")
+	flags.StringVar(&opts.envFile, "env-file", "", ".env file (default is .env next to the executable)")
+	flags.StringVar(&opts.model, "model", "", "model used by all commands, overriding the config")
+	flags.StringVar(&opts.profile, "profile", "", "profile in the config to be applied (default is $GOCHAT_PROFILE)")
+	flags.StringVar(&opts.persona, "persona", "", "persona of chat and ask in the config (default is $GOCHAT_PERSONA or 'default')")
+	flags.BoolVar(&opts.noStream, "no-stream", false, "receive chat answers at once instead of in stream")
+	flags.StringVar(&opts.outputFormat, "output-format", outputFormatText, "output format of ask, findbugs, testgen and sessions (text or json)")
+	_ = root.RegisterFlagCompletionFunc("model", completeModels)
+	_ = root.RegisterFlagCompletionFunc("persona", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg, err := opts.loadConfig()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return cfg.PersonaNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = root.RegisterFlagCompletionFunc("output-format", cobra.FixedCompletions(
+		[]string{outputFormatText, outputFormatJSON}, cobra.ShellCompDirectiveNoFileComp))
+
+	chat := newChatCommand(opts, &resume)
+	root.Flags().AddFlagSet(chat.Flags())
+
+	root.AddCommand(
+		chat,
+		newAskCommand(opts),
+		newCodeCommand(opts, keyCommandsFindBugs, "Find bugs in the file or the function"),
+		newCodeCommand(opts, keyCommandsTestGen, "Generate test for the file or the function"),
+		newRunCommand(opts),
+		newSessionsCommand(opts),
+		newConfigCommand(opts),
+	)
+	return root
+}
+
+// newChatCommand creates the command to start a chat
+func newChatCommand(opts *options, resume *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Start a chat (default)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd.Context(), opts, *resume)
+		},
+	}
+	cmd.Flags().StringVar(resume, "resume", "", "resume the saved session of the id ('latest' for the most recent one)")
+	_ = cmd.RegisterFlagCompletionFunc("resume", completeSessions)
+	return cmd
+}
+
+// newAskCommand creates the command to ask a question once
+func newAskCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   askCommandName + " [question]",
+		Short: "Ask a question once; the standard input is appended if it is not a terminal",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAsk(cmd.Context(), opts, args)
+		},
+	}
+}
+
+// newCodeCommand creates the command to send the code of the file or the function
+func newCodeCommand(opts *options, name, short string) *cobra.Command {
+	req := application.CodeRequest{}
+	cmd := &cobra.Command{
+		Use:   name + " <file> [function]",
+		Short: short,
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.FileName = args[0]
+			if len(args) > 1 {
+				req.FuncName = args[1]
+			}
+			return runCode(cmd.Context(), opts, name, req)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			switch len(args) {
+			case 0:
+				return nil, cobra.ShellCompDirectiveDefault
+			case 1:
+				spec, _ := application.ParseArgSpec("<file> [function]")
+				return application.CompleteArgs(spec, args, toComplete), cobra.ShellCompDirectiveNoFileComp
+			default:
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+		},
+	}
+	cmd.Flags().StringVar(&req.Language, application.FlagLang, "", "language of the code instead of the one guessed from the file extension")
+	if name == keyCommandsTestGen {
+		cmd.Flags().StringVar(&req.Framework, application.FlagFramework, "", "test framework, e.g. testify")
+	}
+	return cmd
+}
+
+// newRunCommand creates the command to run a custom command in the config once
+func newRunCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run <command> [args...]",
+		Short: "Run a custom command in the config once",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCustom(cmd.Context(), opts, args)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// Arguments are completed by the shell as they may be file paths
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			commands, err := cfg.CustomCommands()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			names := make([]string, 0, len(commands))
+			for _, command := range commands {
+				names = append(names, command.Name)
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+}
+
+// newSessionsCommand creates the command to list saved sessions
+func newSessionsCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "sessions",
+		Short: "List saved sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessions(opts)
+		},
+	}
+}
+
+// newConfigCommand creates the command to inspect the config
+func newConfigCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the config",
+	}
+	sources := false
+	show := &cobra.Command{
+		Use:   "show",
+		Short: "Show the effective config with the flags applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			layers, err := opts.loadLayers()
+			if err != nil {
+				return err
+			}
+			cfg, err := layers.decode()
+			if err != nil {
+				return err
+			}
+			if sources {
+				return layers.printSources(os.Stdout)
+			}
+			encoder := yaml.NewEncoder(os.Stdout)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(cfg); err != nil {
+				return err
+			}
+			return encoder.Close()
+		},
+	}
+	show.Flags().BoolVar(&sources, "sources", false, "show where each value comes from")
+
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the config files and environment variables, exiting non-zero on problems",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			layers, err := opts.loadLayers()
+			if err != nil {
+				return err
+			}
+			if _, err := layers.decode(); err != nil {
+				return err
+			}
+			for _, file := range layers.files {
+				if file.found {
+					fmt.Printf("%s: OK\n", file.path)
+				}
+			}
+			fmt.Println("The config is valid")
+			return nil
+		},
+	}
+	cmd.AddCommand(show, validate)
+	return cmd
+}
+
+// validate validates the global flags and fills the defaults from the environment variables
+func (o *options) validate() error {
+	if o.persona == "" {
+		o.persona = os.Getenv(envPersona)
+	}
+	if o.persona == "" {
+		o.persona = defaultPersona
+	}
+	switch o.outputFormat {
+	case outputFormatText, outputFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q", o.outputFormat)
+	}
+}
+
+// setup loads .env and config and creates the provider
+func (o *options) setup() (*Config, internal.Provider, error) {
+	envFile, err := o.defaultPath(o.envFile, envFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	// .env next to the executable is optional, but the one set by the flag is not
+	if o.envFile != "" {
+		if _, err := os.Stat(o.envFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := loadEnv(envFile); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	openaiClient, err := createOpenAIClient(cfg.Request)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := internal.NewTimeoutProvider(internal.NewOpenAIProvider(openaiClient), cfg.Request.Timeouts())
+	return cfg, provider, nil
+}
+
+// loadConfig loads the config and applies the flags
+// The custom models of the config are made available to the services
+func (o *options) loadConfig() (*Config, error) {
+	layers, err := o.loadLayers()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := layers.decode()
+	if err != nil {
+		return nil, err
+	}
+	internal.SetCustomModels(cfg.ContextSizes())
+	return cfg, nil
+}
+
+// loadLayers merges the config in order of built-in defaults, config.yml next to the executable,
+// user config, project config, --config, GOCHAT_* environment variables and the flags
+func (o *options) loadLayers() (*configLayers, error) {
+	layers := newConfigLayers()
+	if err := layers.mergeYAML(sourceBuiltin, []byte(builtinConfig)); err != nil {
+		return nil, err
+	}
+
+	// config.yml next to the executable is kept for compatibility
+	if exec, err := os.Executable(); err == nil {
+		if err := layers.mergeFile(filepath.Join(filepath.Dir(exec), configFileName), false); err != nil {
+			return nil, err
+		}
+	}
+	if userFile, err := internal.DefaultConfigFile(); err == nil {
+		if err := layers.mergeFile(userFile, false); err != nil {
+			return nil, err
+		}
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		projectFile, found := findProjectConfig(cwd)
+		if !found {
+			projectFile = filepath.Join(cwd, projectConfigFileName)
+		}
+		if err := layers.mergeFile(projectFile, false); err != nil {
+			return nil, err
+		}
+	}
+	if o.configFile != "" {
+		if err := layers.mergeFile(o.configFile, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := layers.mergeEnv(); err != nil {
+		return nil, err
+	}
+
+	profile := o.profile
+	if profile == "" {
+		profile = os.Getenv(envProfile)
+	}
+	if profile != "" {
+		values, ok := layers.lookup("profiles", profile)
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found", profile)
+		}
+		layers.merge(layers.values, values, "", "--profile "+profile)
+	}
+	if o.model != "" {
+		// The context sizes of the custom models are validated on decoding
+		declared := map[string]int{}
+		for _, name := range layers.mapKeys("models") {
+			declared[name] = 0
+		}
+		if err := internal.ValidateModelWith(o.model, declared); err != nil {
+			return nil, fmt.Errorf("--model: %w", err)
+		}
+		layers.set([]string{"defaults", "model"}, o.model, "--model")
+		for _, command := range layers.commandNames() {
+			layers.set([]string{"commands", command, "model"}, o.model, "--model")
+		}
+		// Personas are merged over the chat command, so their models are overridden too
+		for _, persona := range layers.mapKeys("personas") {
+			layers.set([]string{"personas", persona, "model"}, o.model, "--model")
+		}
+	}
+	if o.noStream {
+		layers.set([]string{"commands", keyCommandsChat, "stream"}, false, "--no-stream")
+	}
+	return layers, nil
+}
+
+// defaultPath returns the path if set, or the file next to the executable
+func (o *options) defaultPath(path, fileName string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	exec, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("getting executable path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(exec), fileName), nil
+}
+
+// runChat starts a chat, resuming the session if resume is set
+func runChat(ctx context.Context, opts *options, resume string) error {
+	cfg, provider, err := opts.setup()
+	if err != nil {
+		return err
+	}
+
+	printOpenAIConfig()
+	app, err := NewApp(ctx, cfg, provider, opts.persona)
+	if err != nil {
+		return err
+	}
+
+	if resume != "" {
+		if err := app.ChatService.LoadSession(resume); err != nil {
+			return fmt.Errorf("resuming session: %w", err)
+		}
+	}
+
+	// The chat works without hot reload
+	watcher, err := app.watchConfig(opts)
+	if err != nil {
+		slog.Info("Config hot reload is disabled", err)
+	} else {
+		defer watcher.Close()
+	}
+	return app.Execute()
+}
+
+// completeModels completes the known model names
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return internal.KnownModels(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSessions completes the ids of saved sessions
+func completeSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ids := []string{application.LatestSessionID}
+	sessionDir, err := internal.DefaultSessionDir()
+	if err != nil {
+		return ids, cobra.ShellCompDirectiveNoFileComp
+	}
+	sessions, err := internal.NewFileSessionStore(sessionDir).List()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ids, cobra.ShellCompDirectiveNoFileComp
+	}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
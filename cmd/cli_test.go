@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestRootCommand_Args(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name:    "unknown output format",
+			args:    []string{"sessions", "--output-format", "yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "findbugs without file",
+			args:    []string{"findbugs"},
+			wantErr: true,
+		},
+		{
+			name:    "testgen with too many arguments",
+			args:    []string{"testgen", "main.go", "main", "extra"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"review"},
+			wantErr: true,
+		},
+		{
+			name: "completion",
+			args: []string{"completion", "bash"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRootCommand()
+			root.SetArgs(tt.args)
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+
+			err := root.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sota0121/go-ai-chat/application"
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slices"
+)
+
+// replCommand is a command of the chat and its handler bound to App
+type replCommand struct {
+	application.Command
+	handler func(a *App, ctx context.Context, args application.Args) error
+	// complete completes the arguments if not nil
+	complete func(a *App, args []string, word string) []string
+}
+
+// replCommands are the commands of the chat in order of help
+var replCommands = []replCommand{
+	{
+		Command: application.Command{
+			Name: "testgen",
+			Args: "<file> [function]",
+			Help: "generate test for <file> or <function> in <file>",
+			Usages: []application.CommandUsage{
+				{Args: "<file>", Description: "generate test for <file>"},
+				{Args: "<file> <function>", Description: "generate test for <function> in <file>"},
+				{Args: "<file>:<start>-<end>", Description: "generate test for the lines from <start> to <end> of <file>"},
+				{Args: "<file>#<name>,...", Description: "generate test for the declarations of the names in the Go <file>"},
+				{Args: "<pattern>", Description: "generate test for the files matching the glob <pattern>, e.g. 'cmd/*.go'"},
+			},
+			Flags: testGenFlags,
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			req := codeRequest(args)
+			if out := args.Flag(application.FlagOut); out != "" {
+				return writeOut(out, func(w io.Writer) error {
+					return a.TestGenService.GenerateTest(ctx, req, w)
+				})
+			}
+			return a.TestGenService.SendRequestStream(ctx, req)
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "findbugs",
+			Args: "<file> [function]",
+			Help: "find bugs in <file> or <function> in <file>",
+			Usages: []application.CommandUsage{
+				{Args: "<file>", Description: "find bugs in <file>"},
+				{Args: "<file> <function>", Description: "find bugs in <function> in <file>"},
+				{Args: "<file>:<start>-<end>", Description: "find bugs in the lines from <start> to <end> of <file>"},
+				{Args: "<file>#<name>,...", Description: "find bugs in the declarations of the names in the Go <file>"},
+				{Args: "<pattern>", Description: "find bugs in the files matching the glob <pattern>, e.g. 'cmd/*.go'"},
+			},
+			Flags: codeCommandFlags,
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			req := codeRequest(args)
+			if out := args.Flag(application.FlagOut); out != "" {
+				return writeOut(out, func(w io.Writer) error {
+					return a.FindBugService.FindBugs(ctx, req, w)
+				})
+			}
+			return a.FindBugService.SendRequestStream(ctx, req)
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "code",
+			Args: "<file> [text...]",
+			Help: "send the code of <file> to the chat with <text>",
+			Usages: []application.CommandUsage{
+				{Args: "<file> [text]", Description: "send the whole <file>"},
+				{Args: "<file>:<start>-<end> [text]", Description: "send the lines from <start> to <end> of <file>"},
+				{Args: "<file>#<name>,... [text]", Description: "send the declarations of the names in the Go <file>"},
+				{Args: "<pattern> [text]", Description: "send the files matching the glob <pattern>, e.g. 'cmd/*.go'"},
+			},
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			code, err := application.ReadCode(args.Value("file"))
+			if err != nil {
+				return err
+			}
+			if text := args.Value("text"); text != "" {
+				code = text + "\n\n" + code
+			}
+			return a.ChatService.Send(ctx, code)
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "pin",
+			Help: "pin the latest turn so that it is never trimmed from history",
+		},
+		handler: (*App).pin,
+	},
+	{
+		Command: application.Command{
+			Name: "summary",
+			Help: "show the summary of trimmed conversation",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.ChatService.ShowSummary()
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "save",
+			Help: "save the conversation; it is saved automatically after that",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return a.ChatService.SaveSession()
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "sessions",
+			Help: "list saved sessions",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return a.ChatService.ListSessions()
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "load",
+			Args: "<id>",
+			Help: "resume the session of <id> ('latest' for the most recent one)",
+		},
+		handler:  (*App).loadSession,
+		complete: (*App).completeSession,
+	},
+	{
+		Command: application.Command{
+			Name: "retry",
+			Help: "regenerate the latest answer",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return a.ChatService.Retry(ctx)
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "undo",
+			Help: "remove the latest message and its answer",
+		},
+		handler: (*App).undo,
+	},
+	{
+		Command: application.Command{
+			Name:    "edit",
+			Args:    "[text...]",
+			RawArgs: true,
+			Help:    "edit the latest message or the message of #<id> and resend it",
+			Usages: []application.CommandUsage{
+				{Args: "", Description: "edit the latest message and resend it"},
+				{Args: "<text>", Description: "replace the latest message with <text> and resend it"},
+				{Args: "#<id> [<text>]", Description: "edit the message of <id> shown in :tree, forking a new branch"},
+			},
+		},
+		handler: (*App).editMessage,
+	},
+	{
+		Command: application.Command{
+			Name: "alternates",
+			Args: "[n]",
+			Help: "show the alternative answers or switch to the alternative answer <n>",
+			Usages: []application.CommandUsage{
+				{Args: "", Description: "show the alternative answers to the latest message"},
+				{Args: "<n>", Description: "switch the latest answer to the alternative answer <n>"},
+			},
+		},
+		handler: (*App).alternates,
+	},
+	{
+		Command: application.Command{
+			Name: "tree",
+			Help: "show the conversation tree",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.ChatService.ShowTree()
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "branches",
+			Help: "list the branches of the conversation",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.ChatService.ShowBranches()
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "checkout",
+			Args: "<n>",
+			Help: "switch to the branch <n> shown in :branches",
+		},
+		handler: (*App).checkout,
+	},
+	{
+		Command: application.Command{
+			Name: "reset",
+			Help: "clear the conversation and start a new session",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.ChatService.Reset()
+			fmt.Println("Cleared the conversation")
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name:    "system",
+			Args:    "<text...>",
+			RawArgs: true,
+			Help:    "replace the system messages with <text> or append +<text> to them",
+			Usages: []application.CommandUsage{
+				{Args: "<text>", Description: "replace the system messages with <text>"},
+				{Args: "+<text>", Description: "append <text> to the system messages"},
+			},
+		},
+		handler: (*App).system,
+	},
+	{
+		Command: application.Command{
+			Name: "set",
+			Args: "<key> <value>",
+			Help: "change the setting, e.g. model, temperature or stream ('default' to unset)",
+		},
+		handler: (*App).set,
+	},
+	{
+		Command: application.Command{
+			Name: "show",
+			Args: "<what>",
+			Help: "show the effective settings",
+			Usages: []application.CommandUsage{
+				{Args: "settings", Description: "show the effective settings"},
+			},
+		},
+		handler: (*App).show,
+		complete: func(a *App, args []string, word string) []string {
+			if len(args) > 0 || !strings.HasPrefix("settings", word) {
+				return nil
+			}
+			return []string{"settings"}
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "persona",
+			Args: "[name]",
+			Help: "show the current persona or switch to the persona <name>",
+			Usages: []application.CommandUsage{
+				{Args: "", Description: "show the current persona"},
+				{Args: "<name>", Description: "switch to the persona <name> keeping the conversation ('default' for the chat config)"},
+				{Args: "<name> --new", Description: "switch to the persona <name> and start a new conversation"},
+			},
+			Flags: []application.CommandFlag{
+				{Name: "new", Help: "start a new conversation"},
+			},
+		},
+		handler:  (*App).selectPersona,
+		complete: (*App).completePersona,
+	},
+	{
+		Command: application.Command{
+			Name: "personas",
+			Help: "list the personas in the config",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.listPersonas()
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "paste",
+			Help: "input multiple lines until ':end' (or enclose them with '\"\"\"' lines)",
+		},
+		// ':paste' line is handled by inputReader, and the other lines are rejected as they have arguments
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name:    "help",
+			Aliases: []string{"h", "?"},
+			Args:    "[command]",
+			Help:    "show help, or the usage of <command>",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return a.CommandService.ShowHelp(args.Value("command"))
+		},
+		complete: func(a *App, args []string, word string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+			names := a.CommandService.Complete(":" + strings.TrimPrefix(word, ":"))
+			if strings.HasPrefix(word, ":") {
+				return names
+			}
+			for i, name := range names {
+				names[i] = strings.TrimPrefix(name, ":")
+			}
+			return names
+		},
+	},
+	{
+		Command: application.Command{
+			Name: "version",
+			Help: "show version",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			a.CommandService.ShowVersion()
+			return nil
+		},
+	},
+	{
+		Command: application.Command{
+			Name:    "quit",
+			Aliases: []string{"exit", "q"},
+			Help:    "quit the chat",
+		},
+		handler: func(a *App, ctx context.Context, args application.Args) error {
+			return application.ErrQuit
+		},
+	},
+}
+
+// isReplCommand returns true if the name is used by a command of the chat or its alias
+func isReplCommand(name string) bool {
+	for _, command := range replCommands {
+		if command.Name == name || slices.Contains(command.Aliases, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerCommands registers the commands of the chat to CommandService
+func (a *App) registerCommands() error {
+	for _, command := range replCommands {
+		command := command
+		registered := command.Command
+		registered.Handler = func(ctx context.Context, args application.Args) error {
+			return command.handler(a, ctx, args)
+		}
+		if command.complete != nil {
+			registered.Complete = func(args []string, word string) []string {
+				return command.complete(a, args, word)
+			}
+		}
+		if err := a.CommandService.Register(registered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setCustomCommands replaces the custom commands registered to CommandService
+func (a *App) setCustomCommands(commands []application.CustomCommand) error {
+	for _, name := range a.customCommands {
+		a.CommandService.Unregister(name)
+	}
+	a.customCommands = nil
+	for _, command := range commands {
+		service := application.NewCustomCommandService(a.provider, command)
+		err := a.CommandService.Register(application.Command{
+			Name:  command.Name,
+			Args:  command.Usage(),
+			Help:  command.Help,
+			Flags: codeCommandFlags,
+			Handler: func(ctx context.Context, args application.Args) error {
+				if out := args.Flag(application.FlagOut); out != "" {
+					return writeOut(out, func(w io.Writer) error {
+						return service.Run(ctx, args, w)
+					})
+				}
+				return service.SendRequestStream(ctx, args)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		a.customCommands = append(a.customCommands, command.Name)
+	}
+	return nil
+}
+
+// codeCommandFlags are the options of findbugs and custom commands
+var codeCommandFlags = []application.CommandFlag{
+	{Name: application.FlagModel, Value: "model", Help: "model used instead of the one in the config"},
+	{Name: application.FlagLang, Value: "language", Help: "language of the code instead of the one guessed from the file extension"},
+	{Name: application.FlagOut, Value: "file", Help: "write the answer to <file> instead of showing it"},
+}
+
+// testGenFlags are the options of testgen
+var testGenFlags = append(append([]application.CommandFlag{}, codeCommandFlags...), application.CommandFlag{
+	Name: application.FlagFramework, Value: "framework", Help: "test framework, e.g. testify",
+})
+
+// codeRequest returns the request of the code commands with the arguments
+func codeRequest(args application.Args) application.CodeRequest {
+	return application.CodeRequest{
+		FileName:  args.Value("file"),
+		FuncName:  args.Value("function"),
+		Model:     args.Flag(application.FlagModel),
+		Language:  args.Flag(application.FlagLang),
+		Framework: args.Flag(application.FlagFramework),
+	}
+}
+
+// writeOut writes the answer to the file instead of the standard output
+// The answer is written to a temporary file in the same directory, which replaces the file only when the answer is complete,
+// so that the existing file is kept if the request fails or is canceled
+func writeOut(fileName string, answer func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := answer(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The temporary file is only readable by the owner
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(fileName); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), fileName); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote the answer to %s\n", fileName)
+	return nil
+}
+
+func (a *App) pin(ctx context.Context, args application.Args) error {
+	if err := a.ChatService.PinLastTurn(); err != nil {
+		return err
+	}
+	fmt.Println("Pinned the latest turn")
+	return nil
+}
+
+func (a *App) undo(ctx context.Context, args application.Args) error {
+	if err := a.ChatService.Undo(); err != nil {
+		return err
+	}
+	fmt.Println("Removed the latest message and its answer")
+	return nil
+}
+
+func (a *App) loadSession(ctx context.Context, args application.Args) error {
+	return a.ChatService.LoadSession(args.Value("id"))
+}
+
+// completeSession completes the IDs of the saved sessions
+func (a *App) completeSession(args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	sessions, err := a.ChatService.Sessions()
+	if err != nil {
+		return nil
+	}
+	candidates := []string{}
+	for _, id := range append([]string{"latest"}, sessionIDs(sessions)...) {
+		if strings.HasPrefix(id, word) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// sessionIDs returns the IDs of the sessions
+func sessionIDs(sessions []application.SessionInfo) []string {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func (a *App) alternates(ctx context.Context, args application.Args) error {
+	if args.Value("n") == "" {
+		return a.ChatService.ShowAlternates()
+	}
+	n, err := strconv.Atoi(args.Value("n"))
+	if err != nil {
+		return &application.ArgsError{Err: fmt.Errorf("invalid alternative answer %q", args.Value("n"))}
+	}
+	return a.ChatService.SelectAlternate(n)
+}
+
+func (a *App) checkout(ctx context.Context, args application.Args) error {
+	n, err := strconv.Atoi(args.Value("n"))
+	if err != nil {
+		return &application.ArgsError{Err: fmt.Errorf("invalid branch %q", args.Value("n"))}
+	}
+	return a.ChatService.Checkout(n)
+}
+
+func (a *App) system(ctx context.Context, args application.Args) error {
+	text := args.Raw
+	if text == "" {
+		return &application.ArgsError{Err: errors.New("missing argument <text>")}
+	}
+	if strings.HasPrefix(text, "+") {
+		text = strings.TrimSpace(text[1:])
+		if text == "" {
+			return &application.ArgsError{Err: errors.New("missing argument <text> after '+'")}
+		}
+		a.ChatService.AppendSystemMessage(text)
+		fmt.Println("Appended the system message")
+		return nil
+	}
+	a.ChatService.SetSystemMessage(text)
+	fmt.Println("Replaced the system messages")
+	return nil
+}
+
+func (a *App) set(ctx context.Context, args application.Args) error {
+	key, value := args.Value("key"), args.Value("value")
+	if err := a.ChatService.Set(key, value); err != nil {
+		return err
+	}
+	fmt.Printf("Set %s to %s\n", key, value)
+	return nil
+}
+
+func (a *App) show(ctx context.Context, args application.Args) error {
+	if args.Value("what") != "settings" {
+		err := fmt.Errorf("unknown %q%s", args.Value("what"), internal.DidYouMean(args.Value("what"), []string{"settings"}))
+		return &application.ArgsError{Err: err}
+	}
+	a.ChatService.ShowSettings()
+	return nil
+}
+
+func (a *App) selectPersona(ctx context.Context, args application.Args) error {
+	name := args.Value("name")
+	if name == "" {
+		fmt.Printf("Persona: %s\n", a.persona)
+		return nil
+	}
+	err := a.switchPersona(name, args.Has("new"))
+	if errors.Is(err, errUnknownPersona) {
+		return &application.ArgsError{Err: err}
+	}
+	return err
+}
+
+// completePersona completes the persona names and '--new' option
+func (a *App) completePersona(args []string, word string) []string {
+	candidates := []string{}
+	switch len(args) {
+	case 0:
+		for _, name := range a.config.PersonaNames() {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
+		}
+	case 1:
+		if strings.HasPrefix("--new", word) {
+			candidates = append(candidates, "--new")
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/application"
+)
+
+func TestApp_system(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "empty", raw: ""},
+		{name: "plus only", raw: "+"},
+		{name: "plus and spaces", raw: "+  "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The system messages are not changed, so that the app needs no chat service
+			err := (&App{}).system(context.Background(), application.Args{Raw: tt.raw})
+			var argsErr *application.ArgsError
+			if !errors.As(err, &argsErr) {
+				t.Errorf("system() error = %v, want ArgsError", err)
+			}
+		})
+	}
+}
+
+func TestWriteOut(t *testing.T) {
+	errAnswer := errors.New("canceled")
+	tests := []struct {
+		name string
+		// existing is the content of the file before writing, or the file does not exist if nil
+		existing []byte
+		answer   string
+		err      error
+		want     string
+		wantMode os.FileMode
+	}{
+		{
+			name:     "new file",
+			answer:   "func TestAdd(t *testing.T) {}\n",
+			want:     "func TestAdd(t *testing.T) {}\n",
+			wantMode: 0o644,
+		},
+		{
+			name:     "existing file",
+			existing: []byte("old\n"),
+			answer:   "new\n",
+			want:     "new\n",
+			wantMode: 0o600,
+		},
+		{
+			name:     "failed answer keeps the file",
+			existing: []byte("old\n"),
+			answer:   "partial",
+			err:      errAnswer,
+			want:     "old\n",
+			wantMode: 0o600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName := filepath.Join(dir, "calc_test.go")
+			if tt.existing != nil {
+				if err := os.WriteFile(fileName, tt.existing, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := writeOut(fileName, func(w io.Writer) error {
+				// The file must not be truncated while the answer is being written
+				if tt.existing != nil {
+					if data, err := os.ReadFile(fileName); err != nil || string(data) != string(tt.existing) {
+						t.Errorf("file during the answer = %q, %v, want %q", data, err, tt.existing)
+					}
+				}
+				if _, err := io.WriteString(w, tt.answer); err != nil {
+					return err
+				}
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("writeOut() error = %v, want %v", err, tt.err)
+			}
+
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("file = %q, want %q", data, tt.want)
+			}
+			info, err := os.Stat(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("files = %d, want only %s without temporary files", len(entries), filepath.Base(fileName))
+			}
+		})
+	}
+}
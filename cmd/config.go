@@ -0,0 +1,495 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/sota0121/go-ai-chat/application"
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slices"
+)
+
+type Config struct {
+	Defaults ModelConfig        `yaml:"defaults"`
+	Commands map[string]Command `yaml:"commands,omitempty"`
+	Personas map[string]Persona `yaml:"personas,omitempty"`
+	Request  RequestConfig      `yaml:"request,omitempty"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// Models declares the models not known to gochat, e.g. the ones of OpenAI compatible servers
+	Models map[string]ModelInfo `yaml:"models,omitempty"`
+
+	// promptTexts are the contents of the prompt files read on loading by their paths,
+	// so that the changes of the prompt templates are found on reload
+	promptTexts map[string]string
+}
+
+// Profile is a named set of overrides selected with --profile
+type Profile struct {
+	Defaults ModelConfig        `yaml:"defaults,omitempty"`
+	Commands map[string]Command `yaml:"commands,omitempty"`
+}
+
+type Command struct {
+	ModelConfig    `yaml:",inline"`
+	SystemMessages []string `yaml:"systemMessages,omitempty"`
+	UserMessages   []string `yaml:"userMessages,omitempty"`
+	Summarize      bool     `yaml:"summarize,omitempty"`
+	Stream         *bool    `yaml:"stream,omitempty"`
+	// SummaryPrompt is the text/template of the request to summarize trimmed histories of chat
+	SummaryPrompt string `yaml:"summaryPrompt,omitempty"`
+	// Prompt is the text/template of the prompt of findbugs, testgen and custom commands
+	Prompt string `yaml:"prompt,omitempty"`
+	// PromptFile is the file of the prompt template relative to the config file
+	PromptFile string `yaml:"promptFile,omitempty"`
+	// Args is the argument spec of custom commands, e.g. "<file> [function]"
+	Args string `yaml:"args,omitempty"`
+	// Help is the description of custom commands shown in :help
+	Help string `yaml:"help,omitempty"`
+	// ExtractFunction sends the code of the function instead of the whole file in custom commands (default true)
+	ExtractFunction *bool `yaml:"extractFunction,omitempty"`
+}
+
+// Persona is a named set of messages and parameters of the chat selected with --persona or :persona
+// Messages replace the ones of the chat command if set, and parameters override them
+type Persona struct {
+	ModelConfig    `yaml:",inline"`
+	Description    string   `yaml:"description,omitempty"`
+	SystemMessages []string `yaml:"systemMessages,omitempty"`
+	UserMessages   []string `yaml:"userMessages,omitempty"`
+}
+
+// ModelInfo is the declaration of a custom model
+type ModelInfo struct {
+	// ContextSize is the maximum number of tokens of the prompt and the completion
+	ContextSize int `yaml:"contextSize"`
+}
+
+// ModelConfig is the model and sampling parameters
+// Unset parameters fall back to the defaults
+type ModelConfig struct {
+	Model            string   `yaml:"model,omitempty"`
+	Temperature      *float32 `yaml:"temperature,omitempty"`
+	TopP             *float32 `yaml:"topP,omitempty"`
+	MaxTokens        int      `yaml:"maxTokens,omitempty"`
+	Stop             []string `yaml:"stop,omitempty"`
+	PresencePenalty  *float32 `yaml:"presencePenalty,omitempty"`
+	FrequencyPenalty *float32 `yaml:"frequencyPenalty,omitempty"`
+}
+
+// RequestConfig is the retry policy and timeouts of requests
+// Unset values fall back to the defaults
+type RequestConfig struct {
+	MaxAttempts       int           `yaml:"maxAttempts,omitempty"`
+	InitialBackoff    time.Duration `yaml:"initialBackoff,omitempty"`
+	MaxBackoff        time.Duration `yaml:"maxBackoff,omitempty"`
+	Timeout           time.Duration `yaml:"timeout,omitempty"`
+	FirstTokenTimeout time.Duration `yaml:"firstTokenTimeout,omitempty"`
+}
+
+const (
+	defaultRequestTimeout    = 5 * time.Minute
+	defaultFirstTokenTimeout = time.Minute
+)
+
+// defaultPersona is the name to use the chat command config without persona
+const defaultPersona = "default"
+
+// errUnknownPersona is returned when the persona is not in the config
+var errUnknownPersona = errors.New("unknown persona")
+
+const (
+	keyCommandsChat     = "chat"
+	keyCommandsFindBugs = "findbugs"
+	keyCommandsTestGen  = "testgen"
+)
+
+// ModelParams returns the model parameters of the command
+// Parameters are merged in order of defaults and command config
+func (c *Config) ModelParams(command string) internal.ModelParams {
+	return c.modelConfig(command).toModelParams()
+}
+
+// modelConfig returns the merged model config of the command
+func (c *Config) modelConfig(command string) ModelConfig {
+	merged := ModelConfig{
+		Model: internal.DefaultModel,
+	}
+	merged = merged.merge(c.Defaults)
+	return merged.merge(c.Commands[command].ModelConfig)
+}
+
+// ChatConfig returns the config of ChatService with the persona applied
+// The chat command config is used as is for defaultPersona
+func (c *Config) ChatConfig(persona string) (application.ChatConfig, error) {
+	chatCommand := c.Commands[keyCommandsChat]
+	summaryPrompt, err := c.SummaryPrompt()
+	if err != nil {
+		return application.ChatConfig{}, fmt.Errorf("commands.%s.summaryPrompt: %w", keyCommandsChat, err)
+	}
+	chatConfig := application.ChatConfig{
+		Params:         c.ModelParams(keyCommandsChat),
+		SystemMessages: chatCommand.SystemMessages,
+		UserMessages:   chatCommand.UserMessages,
+		Summarize:      chatCommand.Summarize,
+		Stream:         chatCommand.Stream == nil || *chatCommand.Stream,
+		SummaryPrompt:  summaryPrompt,
+	}
+	if persona == defaultPersona {
+		return chatConfig, nil
+	}
+
+	p, ok := c.Personas[persona]
+	if !ok {
+		return application.ChatConfig{}, fmt.Errorf("%w %q%s", errUnknownPersona, persona, internal.DidYouMean(persona, c.PersonaNames()))
+	}
+	chatConfig.Params = c.modelConfig(keyCommandsChat).merge(p.ModelConfig).toModelParams()
+	if p.SystemMessages != nil {
+		chatConfig.SystemMessages = p.SystemMessages
+	}
+	if p.UserMessages != nil {
+		chatConfig.UserMessages = p.UserMessages
+	}
+	return chatConfig, nil
+}
+
+// PromptTemplate returns the prompt template of the command, or nil to use the built-in one
+func (c *Config) PromptTemplate(command string) (*template.Template, error) {
+	config := c.Commands[command]
+	args, err := application.ParseArgSpec(config.Args)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		names = append(names, arg.Name)
+	}
+
+	switch {
+	case config.PromptFile != "":
+		text, err := c.promptText(config.PromptFile)
+		if err != nil {
+			return nil, err
+		}
+		return application.ParsePrompt(filepath.Base(config.PromptFile), text, names...)
+	case config.Prompt != "":
+		return application.ParsePrompt(command, config.Prompt, names...)
+	default:
+		return nil, nil
+	}
+}
+
+// SummaryPrompt returns the template of the request to summarize trimmed histories, or nil to use the built-in one
+func (c *Config) SummaryPrompt() (*template.Template, error) {
+	text := c.Commands[keyCommandsChat].SummaryPrompt
+	if text == "" {
+		return nil, nil
+	}
+	return application.ParseSummaryPrompt("summaryPrompt", text)
+}
+
+// PromptFiles returns the prompt files of the commands in order of command names
+func (c *Config) PromptFiles() []string {
+	files := []string{}
+	for _, name := range sortedKeys(c.Commands) {
+		if file := c.Commands[name].PromptFile; file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// readPromptFiles reads the prompt files of the commands
+// Files which cannot be read are reported by validate
+func (c *Config) readPromptFiles() {
+	c.promptTexts = map[string]string{}
+	for _, file := range c.PromptFiles() {
+		if text, err := os.ReadFile(file); err == nil {
+			c.promptTexts[file] = string(text)
+		}
+	}
+}
+
+// promptText returns the content of the prompt file read on loading, or reads the file if it is not read yet
+func (c *Config) promptText(file string) (string, error) {
+	if text, ok := c.promptTexts[file]; ok {
+		return text, nil
+	}
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// CustomCommands returns the commands other than the built-in ones in order of names
+func (c *Config) CustomCommands() ([]application.CustomCommand, error) {
+	commands := []application.CustomCommand{}
+	for _, name := range sortedKeys(c.Commands) {
+		if slices.Contains(builtinCommands, name) {
+			continue
+		}
+		config := c.Commands[name]
+		args, err := application.ParseArgSpec(config.Args)
+		if err != nil {
+			return nil, fmt.Errorf("commands.%s.args: %w", name, err)
+		}
+		prompt, err := c.PromptTemplate(name)
+		if err != nil {
+			return nil, fmt.Errorf("commands.%s: %w", name, err)
+		}
+		commands = append(commands, application.CustomCommand{
+			Name:            name,
+			Args:            args,
+			Help:            config.Help,
+			Params:          c.ModelParams(name),
+			Prompt:          prompt,
+			ExtractFunction: config.ExtractFunction == nil || *config.ExtractFunction,
+		})
+	}
+	return commands, nil
+}
+
+// PersonaNames returns defaultPersona and the names of the personas in order
+func (c *Config) PersonaNames() []string {
+	return append([]string{defaultPersona}, sortedKeys(c.Personas)...)
+}
+
+// ContextSizes returns the context sizes of the custom models by their names
+func (c *Config) ContextSizes() map[string]int {
+	sizes := make(map[string]int, len(c.Models))
+	for name, model := range c.Models {
+		sizes[name] = model.ContextSize
+	}
+	return sizes
+}
+
+// validate validates config
+// The errors of all the invalid values are joined
+func (c *Config) validate() error {
+	errs := []error{}
+	for _, name := range sortedKeys(c.Models) {
+		if c.Models[name].ContextSize <= 0 {
+			errs = append(errs, &configError{key: joinKey(joinKey("models", name), "contextSize"), err: errors.New("must be positive")})
+		}
+	}
+	models := c.ContextSizes()
+	errs = append(errs, c.Defaults.validate("defaults", models)...)
+	errs = append(errs, validateCommands("commands", c.Commands, models)...)
+	for _, name := range sortedKeys(c.Personas) {
+		key := joinKey("personas", name)
+		if name == defaultPersona {
+			errs = append(errs, &configError{key: key, err: fmt.Errorf("%q is reserved for the chat command config", name)})
+		}
+		errs = append(errs, c.Personas[name].validate(key, models)...)
+	}
+	errs = append(errs, c.Request.validate("request")...)
+	for _, name := range sortedKeys(c.Profiles) {
+		key := joinKey("profiles", name)
+		errs = append(errs, c.Profiles[name].Defaults.validate(joinKey(key, "defaults"), models)...)
+		// Commands in profiles are partial overrides validated after applied
+		for _, command := range sortedKeys(c.Profiles[name].Commands) {
+			commandKey := joinKey(key, "commands."+command)
+			errs = append(errs, c.Profiles[name].Commands[command].validate(commandKey, models)...)
+			if command != keyCommandsChat {
+				errs = append(errs, validateChatOnlyKeys(commandKey, c.Profiles[name].Commands[command])...)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateCommands validates the commands in order of names
+// models are the context sizes of the custom models which can be used besides the known ones
+func validateCommands(key string, commands map[string]Command, models map[string]int) []error {
+	errs := []error{}
+	for _, name := range sortedKeys(commands) {
+		command := commands[name]
+		commandKey := joinKey(key, name)
+		errs = append(errs, command.validate(commandKey, models)...)
+		if name != keyCommandsChat {
+			errs = append(errs, validateChatOnlyKeys(commandKey, command)...)
+		}
+
+		custom := !slices.Contains(builtinCommands, name)
+		switch {
+		case custom && isReplCommand(name):
+			errs = append(errs, &configError{key: commandKey, err: fmt.Errorf("custom command conflicts with the built-in command :%s", name)})
+			continue
+		case custom && command.Prompt == "" && command.PromptFile == "":
+			err := fmt.Errorf("custom command requires prompt or promptFile%s", internal.DidYouMean(name, builtinCommands))
+			errs = append(errs, &configError{key: commandKey, err: err})
+			continue
+		case !custom && (command.Args != "" || command.Help != "" || command.ExtractFunction != nil):
+			errs = append(errs, &configError{key: commandKey, err: errors.New("args, help and extractFunction are only for custom commands")})
+		}
+		if _, err := application.ParseArgSpec(command.Args); err != nil {
+			errs = append(errs, &configError{key: joinKey(commandKey, "args"), err: err})
+			continue
+		}
+
+		if name == keyCommandsChat && command.SummaryPrompt != "" {
+			if _, err := application.ParseSummaryPrompt("summaryPrompt", command.SummaryPrompt); err != nil {
+				errs = append(errs, &configError{key: joinKey(commandKey, "summaryPrompt"), err: err})
+			}
+		}
+
+		switch {
+		case command.Prompt == "" && command.PromptFile == "":
+		case name == keyCommandsChat:
+			errs = append(errs, &configError{key: commandKey, err: errors.New("prompt is not supported by chat, use summaryPrompt for the summary")})
+		case command.Prompt != "" && command.PromptFile != "":
+			errs = append(errs, &configError{key: commandKey, err: errors.New("prompt and promptFile cannot be set together")})
+		default:
+			// Parse and execute the template with sample data so that mistakes are found before use
+			cfg := Config{Commands: map[string]Command{name: command}}
+			if _, err := cfg.PromptTemplate(name); err != nil {
+				errs = append(errs, &configError{key: joinKey(commandKey, promptKey(command)), err: err})
+			}
+		}
+	}
+	return errs
+}
+
+// validateChatOnlyKeys reports the keys set in the command other than chat which are only valid for chat
+func validateChatOnlyKeys(key string, command Command) []error {
+	keys := []string{}
+	if command.SystemMessages != nil {
+		keys = append(keys, "systemMessages")
+	}
+	if command.UserMessages != nil {
+		keys = append(keys, "userMessages")
+	}
+	if command.Summarize {
+		keys = append(keys, "summarize")
+	}
+	if command.Stream != nil {
+		keys = append(keys, "stream")
+	}
+	if command.SummaryPrompt != "" {
+		keys = append(keys, "summaryPrompt")
+	}
+	errs := []error{}
+	for _, k := range keys {
+		errs = append(errs, &configError{key: joinKey(key, k), err: errors.New("only valid for chat")})
+	}
+	return errs
+}
+
+// promptKey returns the key of the prompt set in the command
+func promptKey(command Command) string {
+	if command.PromptFile != "" {
+		return "promptFile"
+	}
+	return "prompt"
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RetryPolicy returns the retry policy of requests
+func (r RequestConfig) RetryPolicy() internal.RetryPolicy {
+	return internal.RetryPolicy{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: r.InitialBackoff,
+		MaxBackoff:     r.MaxBackoff,
+	}
+}
+
+// Timeouts returns the timeouts of requests
+func (r RequestConfig) Timeouts() internal.Timeouts {
+	timeouts := internal.Timeouts{
+		Request:    r.Timeout,
+		FirstToken: r.FirstTokenTimeout,
+	}
+	if timeouts.Request == 0 {
+		timeouts.Request = defaultRequestTimeout
+	}
+	if timeouts.FirstToken == 0 {
+		timeouts.FirstToken = defaultFirstTokenTimeout
+	}
+	return timeouts
+}
+
+// validate validates the retry policy and timeouts
+func (r RequestConfig) validate(key string) []error {
+	errs := []error{}
+	if err := r.RetryPolicy().Validate(); err != nil {
+		errs = append(errs, &configError{key: key, err: err})
+	}
+	if err := r.Timeouts().Validate(); err != nil {
+		errs = append(errs, &configError{key: key, err: err})
+	}
+	return errs
+}
+
+// merge overrides parameters with the ones set in other
+func (m ModelConfig) merge(other ModelConfig) ModelConfig {
+	if other.Model != "" {
+		m.Model = other.Model
+	}
+	if other.Temperature != nil {
+		m.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		m.TopP = other.TopP
+	}
+	if other.MaxTokens != 0 {
+		m.MaxTokens = other.MaxTokens
+	}
+	if other.Stop != nil {
+		m.Stop = other.Stop
+	}
+	if other.PresencePenalty != nil {
+		m.PresencePenalty = other.PresencePenalty
+	}
+	if other.FrequencyPenalty != nil {
+		m.FrequencyPenalty = other.FrequencyPenalty
+	}
+	return m
+}
+
+// validate validates model name and ranges of sampling parameters
+// models are the context sizes of the custom models which can be used besides the known ones
+func (m ModelConfig) validate(key string, models map[string]int) []error {
+	errs := []error{}
+	if m.Model != "" {
+		if err := internal.ValidateModelWith(m.Model, models); err != nil {
+			errs = append(errs, &configError{key: joinKey(key, "model"), err: err})
+		}
+	}
+	if err := m.toModelParams().Validate(); err != nil {
+		var paramErr *internal.ParamError
+		if errors.As(err, &paramErr) {
+			err = &configError{key: joinKey(key, paramErr.Param), err: errors.New(paramErr.Reason)}
+		} else {
+			err = &configError{key: key, err: err}
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// toModelParams converts to model parameters of requests
+func (m ModelConfig) toModelParams() internal.ModelParams {
+	return internal.ModelParams{
+		Model:            m.Model,
+		Temperature:      m.Temperature,
+		TopP:             m.TopP,
+		MaxTokens:        m.MaxTokens,
+		Stop:             m.Stop,
+		PresencePenalty:  m.PresencePenalty,
+		FrequencyPenalty: m.FrequencyPenalty,
+	}
+}
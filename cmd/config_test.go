@@ -0,0 +1,219 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/application"
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+func TestConfig_ChatConfig(t *testing.T) {
+	cfg := &Config{
+		Defaults: ModelConfig{Temperature: float32Ptr(0.5)},
+		Commands: map[string]Command{
+			keyCommandsChat: {
+				ModelConfig:    ModelConfig{MaxTokens: 256},
+				SystemMessages: []string{"You are a bot"},
+				UserMessages:   []string{"Answer shortly"},
+			},
+		},
+		Personas: map[string]Persona{
+			"reviewer": {
+				ModelConfig:    ModelConfig{Model: "gpt-4", Temperature: float32Ptr(0)},
+				SystemMessages: []string{"You are a reviewer"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		persona string
+		want    application.ChatConfig
+		wantErr string
+	}{
+		{
+			name:    "default persona",
+			persona: defaultPersona,
+			want: application.ChatConfig{
+				Params:         internal.ModelParams{Model: internal.DefaultModel, Temperature: float32Ptr(0.5), MaxTokens: 256},
+				SystemMessages: []string{"You are a bot"},
+				UserMessages:   []string{"Answer shortly"},
+				Stream:         true,
+			},
+		},
+		{
+			name:    "persona overrides the chat command",
+			persona: "reviewer",
+			want: application.ChatConfig{
+				Params:         internal.ModelParams{Model: "gpt-4", Temperature: float32Ptr(0), MaxTokens: 256},
+				SystemMessages: []string{"You are a reviewer"},
+				UserMessages:   []string{"Answer shortly"},
+				Stream:         true,
+			},
+		},
+		{
+			name:    "unknown persona",
+			persona: "reviwer",
+			wantErr: `unknown persona "reviwer"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.ChatConfig(tt.persona)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "reviewer") {
+					t.Fatalf("ChatConfig() error = %v, want %q with a suggestion", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChatConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChatConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ChatConfig_summaryPrompt(t *testing.T) {
+	cfg := &Config{}
+	got, err := cfg.ChatConfig(defaultPersona)
+	if err != nil {
+		t.Fatalf("ChatConfig() error = %v", err)
+	}
+	if got.SummaryPrompt != nil {
+		t.Errorf("SummaryPrompt = %v, want nil for the built-in prompt", got.SummaryPrompt.Name())
+	}
+
+	cfg.Commands = map[string]Command{keyCommandsChat: {SummaryPrompt: "Summarize in English.\n{{.Conversation}}"}}
+	got, err = cfg.ChatConfig(defaultPersona)
+	if err != nil {
+		t.Fatalf("ChatConfig() error = %v", err)
+	}
+	var b strings.Builder
+	if err := got.SummaryPrompt.Execute(&b, application.SummaryData{Conversation: "user: Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Summarize in English.\nuser: Hello"; b.String() != want {
+		t.Errorf("SummaryPrompt renders %q, want %q", b.String(), want)
+	}
+
+	cfg.Commands = map[string]Command{keyCommandsChat: {SummaryPrompt: "{{.Code}}"}}
+	if _, err := cfg.ChatConfig(defaultPersona); err == nil || !strings.Contains(err.Error(), "commands.chat.summaryPrompt: ") {
+		t.Errorf("ChatConfig() error = %v, want the error of the prompt", err)
+	}
+}
+
+func TestConfig_validate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		// wantErrs are the messages contained in the error, or no error is expected if empty
+		wantErrs []string
+	}{
+		{
+			name: "known model",
+			cfg:  Config{Defaults: ModelConfig{Model: "gpt-4"}},
+		},
+		{
+			name:     "unknown model",
+			cfg:      Config{Defaults: ModelConfig{Model: "gpt4"}},
+			wantErrs: []string{`defaults.model: unknown model "gpt4" (did you mean "gpt-4"?)`},
+		},
+		{
+			name: "non-finite parameters",
+			cfg: Config{
+				Defaults: ModelConfig{Temperature: float32Ptr(float32(math.NaN()))},
+				Personas: map[string]Persona{"reviewer": {ModelConfig: ModelConfig{TopP: float32Ptr(float32(math.Inf(1)))}}},
+			},
+			wantErrs: []string{
+				"defaults.temperature: must be a finite number",
+				"personas.reviewer.topP: must be a finite number",
+			},
+		},
+		{
+			name: "custom model",
+			cfg: Config{
+				Models:   map[string]ModelInfo{"llama-2-13b-chat": {ContextSize: 4096}},
+				Defaults: ModelConfig{Model: "llama-2-13b-chat"},
+				Personas: map[string]Persona{"reviewer": {ModelConfig: ModelConfig{Model: "llama-2-13b-chat"}}},
+			},
+		},
+		{
+			name: "custom model without context size",
+			cfg: Config{
+				Models:   map[string]ModelInfo{"llama-2-13b-chat": {}},
+				Commands: map[string]Command{keyCommandsChat: {ModelConfig: ModelConfig{Model: "llama-2-13b-chat"}}},
+			},
+			wantErrs: []string{"models.llama-2-13b-chat.contextSize: must be positive"},
+		},
+		{
+			name: "undeclared custom model",
+			cfg: Config{
+				Models:   map[string]ModelInfo{"llama-2-13b-chat": {ContextSize: 4096}},
+				Commands: map[string]Command{keyCommandsChat: {ModelConfig: ModelConfig{Model: "llama-2-70b-chat"}}},
+			},
+			wantErrs: []string{`commands.chat.model: unknown model "llama-2-70b-chat" (did you mean "llama-2-13b-chat"?)`},
+		},
+		{
+			name: "chat-only keys of other commands",
+			cfg: Config{
+				Commands: map[string]Command{
+					keyCommandsFindBugs: {Stream: new(bool), SystemMessages: []string{"You are a reviewer"}},
+					keyCommandsTestGen:  {SummaryPrompt: "{{.Conversation}}"},
+					"explain":           {Prompt: "Explain {{.Code}}", Summarize: true, UserMessages: []string{"Be brief"}},
+				},
+				Profiles: map[string]Profile{"quiet": {Commands: map[string]Command{keyCommandsTestGen: {Stream: new(bool)}}}},
+			},
+			wantErrs: []string{
+				"commands.findbugs.systemMessages: only valid for chat",
+				"commands.findbugs.stream: only valid for chat",
+				"commands.testgen.summaryPrompt: only valid for chat",
+				"commands.explain.userMessages: only valid for chat",
+				"commands.explain.summarize: only valid for chat",
+				"profiles.quiet.commands.testgen.stream: only valid for chat",
+			},
+		},
+		{
+			name: "summary prompt",
+			cfg:  Config{Commands: map[string]Command{keyCommandsChat: {SummaryPrompt: "Summarize {{.Summary}}\n{{.Conversation}}"}}},
+		},
+		{
+			name:     "summary prompt with unknown variables",
+			cfg:      Config{Commands: map[string]Command{keyCommandsChat: {SummaryPrompt: "{{.Summary}} {{.History}}"}}},
+			wantErrs: []string{"commands.chat.summaryPrompt: "},
+		},
+		{
+			name:     "prompt of chat",
+			cfg:      Config{Commands: map[string]Command{keyCommandsChat: {Prompt: "Summarize {{.Conversation}}"}}},
+			wantErrs: []string{"commands.chat: prompt is not supported by chat"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() error = nil, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	multiLineDelimiter = `"""`
+	pasteStartCommand  = ":paste"
+	pasteEndCommand    = ":end"
+	continuationPrompt = "...   "
+)
+
+// errInterrupted is returned when the user pressed Ctrl-C at the prompt
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads a line of user input
+// ReadLine returns io.EOF when there is no more input and errInterrupted on Ctrl-C
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	ReadLineWithDefault(prompt, defaultText string) (string, error)
+	// Stdout returns the writer to print messages without breaking the prompt being edited
+	Stdout() io.Writer
+	Close() error
+}
+
+// newBufferedLineReader creates lineReader which reads lines from r without length limit
+func newBufferedLineReader(r io.Reader) lineReader {
+	return &bufferedLineReader{
+		reader: bufio.NewReader(r),
+	}
+}
+
+type bufferedLineReader struct {
+	reader *bufio.Reader
+}
+
+var _ lineReader = (*bufferedLineReader)(nil)
+
+// ReadLine prints the prompt and reads a line
+// The last line without a newline is returned before io.EOF
+func (r *bufferedLineReader) ReadLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := r.reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		if errors.Is(err, io.EOF) {
+			// Move to the next line as the user pressed Ctrl-D
+			fmt.Println()
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadLineWithDefault reads a line
+// The default text is ignored since the line cannot be edited
+func (r *bufferedLineReader) ReadLineWithDefault(prompt, _ string) (string, error) {
+	return r.ReadLine(prompt)
+}
+
+// Stdout returns the standard output
+func (r *bufferedLineReader) Stdout() io.Writer {
+	return os.Stdout
+}
+
+// Close does nothing since the reader does not own the input
+func (r *bufferedLineReader) Close() error {
+	return nil
+}
+
+// inputReader reads user input which may span multiple lines
+// Multiple lines can be input between '"""' lines or ':paste' and ':end' lines
+type inputReader struct {
+	lines lineReader
+}
+
+func newInputReader(lines lineReader) *inputReader {
+	return &inputReader{
+		lines: lines,
+	}
+}
+
+// ReadInput reads a single input
+// This returns true if the input spans multiple lines, which is never treated as a command
+func (r *inputReader) ReadInput(prompt string) (string, bool, error) {
+	return r.ReadInputWithDefault(prompt, "")
+}
+
+// ReadInputWithDefault reads a single input starting with the default text to be edited
+func (r *inputReader) ReadInputWithDefault(prompt, defaultText string) (string, bool, error) {
+	line, err := r.lines.ReadLineWithDefault(prompt, defaultText)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch strings.TrimSpace(line) {
+	case multiLineDelimiter:
+		text, err := r.readUntil(multiLineDelimiter)
+		return text, true, err
+	case pasteStartCommand:
+		fmt.Printf("Paste mode: input '%s' to finish\n", pasteEndCommand)
+		text, err := r.readUntil(pasteEndCommand)
+		return text, true, err
+	default:
+		return line, false, nil
+	}
+}
+
+// readUntil reads lines until the terminator line and joins them
+// If the input ends before the terminator, the lines read so far are returned
+func (r *inputReader) readUntil(terminator string) (string, error) {
+	lines := []string{}
+	for {
+		line, err := r.lines.ReadLine(continuationPrompt)
+		if errors.Is(err, io.EOF) {
+			return strings.Join(lines, "\n"), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == terminator {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// Stdout returns the writer to print messages while the input is being read
+func (r *inputReader) Stdout() io.Writer {
+	return r.lines.Stdout()
+}
+
+// Close closes the underlying line reader
+func (r *inputReader) Close() error {
+	return r.lines.Close()
+}
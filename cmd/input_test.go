@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInputReader_ReadInput(t *testing.T) {
+	type input struct {
+		text      string
+		multiLine bool
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []input
+	}{
+		{
+			name:  "single lines",
+			input: "Hello\n:help\n",
+			want:  []input{{"Hello", false}, {":help", false}},
+		},
+		{
+			name:  "last line without newline",
+			input: "Hello\r\nBye",
+			want:  []input{{"Hello", false}, {"Bye", false}},
+		},
+		{
+			name:  "delimited lines",
+			input: "\"\"\"\nfunc main() {\n}\n\"\"\"\nBye\n",
+			want:  []input{{"func main() {\n}", true}, {"Bye", false}},
+		},
+		{
+			name:  "command in delimited lines",
+			input: "\"\"\"\n:quit\n\"\"\"\n",
+			want:  []input{{":quit", true}},
+		},
+		{
+			name:  "paste mode",
+			input: ":paste\nline 1\n\nline 3\n  :end  \n",
+			want:  []input{{"line 1\n\nline 3", true}},
+		},
+		{
+			name:  "input ends before the terminator",
+			input: "\"\"\"\nline 1\nline 2",
+			want:  []input{{"line 1\nline 2", true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newInputReader(newBufferedLineReader(strings.NewReader(tt.input)))
+
+			got := []input{}
+			for {
+				text, multiLine, err := r.ReadInput("> ")
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, input{text, multiLine})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+const interruptHint = "(To exit, press Ctrl-C again or input ':quit')"
+
+// interruptHandler handles Ctrl-C while the REPL is running
+// Ctrl-C cancels the running request, and the second Ctrl-C at an idle prompt exits
+type interruptHandler struct {
+	mu          sync.Mutex
+	signals     chan os.Signal
+	cancel      context.CancelFunc
+	interrupted bool
+	onExit      func()
+}
+
+// newInterruptHandler creates interruptHandler
+// onExit is called when the user pressed Ctrl-C twice while the prompt cannot return errInterrupted
+func newInterruptHandler(onExit func()) *interruptHandler {
+	return &interruptHandler{
+		signals: make(chan os.Signal, 1),
+		onExit:  onExit,
+	}
+}
+
+// Start starts handling Ctrl-C instead of terminating the process
+func (h *interruptHandler) Start() {
+	signal.Notify(h.signals, os.Interrupt)
+	go func() {
+		for range h.signals {
+			h.handleSignal()
+		}
+	}()
+}
+
+// Stop stops handling Ctrl-C
+func (h *interruptHandler) Stop() {
+	signal.Stop(h.signals)
+	close(h.signals)
+}
+
+// WithCancel returns the context of a request which is canceled by Ctrl-C
+// The returned cancel function must be called when the request finishes
+func (h *interruptHandler) WithCancel(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cancel = cancel
+	h.interrupted = false
+
+	return ctx, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.cancel = nil
+		cancel()
+	}
+}
+
+// Interrupt records Ctrl-C at an idle prompt
+// This returns true if it is pressed again without any input in between
+func (h *interruptHandler) Interrupt() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.interrupted {
+		return true
+	}
+	h.interrupted = true
+	fmt.Println(interruptHint)
+	return false
+}
+
+// Reset forgets Ctrl-C at the prompt since the user input something
+func (h *interruptHandler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.interrupted = false
+}
+
+// handleSignal cancels the running request
+// Without a request, the prompt is blocked in reading the input, so this exits on the second Ctrl-C
+func (h *interruptHandler) handleSignal() {
+	h.mu.Lock()
+	cancel := h.cancel
+	h.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		return
+	}
+
+	fmt.Println()
+	if h.Interrupt() {
+		h.onExit()
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	projectConfigFileName = ".gochat.yml"
+	envPrefix             = "GOCHAT_"
+	// envModel is a short alias of GOCHAT_DEFAULTS_MODEL
+	envModel = envPrefix + "MODEL"
+	// envProfile is the default of --profile
+	envProfile = envPrefix + "PROFILE"
+	// envPersona is the default of --persona
+	envPersona = envPrefix + "PERSONA"
+
+	sourceBuiltin = "built-in"
+)
+
+// builtinConfig is the lowest layer of the config
+// testgen uses temperature 0 for reproducible output
+var builtinConfig = fmt.Sprintf(`
+defaults:
+  model: %q
+commands:
+  testgen:
+    temperature: 0
+request:
+  maxAttempts: %d
+  initialBackoff: %s
+  maxBackoff: %s
+  timeout: %s
+  firstTokenTimeout: %s
+`, internal.DefaultModel,
+	internal.DefaultMaxAttempts, internal.DefaultInitialBackoff, internal.DefaultMaxBackoff,
+	defaultRequestTimeout, defaultFirstTokenTimeout)
+
+// configValues is the generic representation of the config decoded from YAML
+type configValues = map[string]interface{}
+
+// configLayers merges the config from layers while recording the source of each value
+// Maps are merged recursively, and the other values including lists are replaced
+type configLayers struct {
+	values  configValues
+	sources map[string]string
+	// files are the config files looked up and whether they are found
+	files []configFile
+	// problems are the schema errors found in the layers
+	problems []error
+}
+
+type configFile struct {
+	path  string
+	found bool
+}
+
+// configEntry is a value of the config and its source
+type configEntry struct {
+	key    string
+	value  interface{}
+	source string
+}
+
+func newConfigLayers() *configLayers {
+	return &configLayers{
+		values:  configValues{},
+		sources: map[string]string{},
+	}
+}
+
+// mergeYAML merges the YAML document as a layer
+func (l *configLayers) mergeYAML(source string, data []byte) error {
+	values := configValues{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parsing config %s: %w", source, err)
+	}
+	l.merge(l.values, values, "", source)
+	return nil
+}
+
+// resolvePaths makes the relative paths of promptFile relative to dir recursively
+func resolvePaths(values configValues, dir string) {
+	for key, value := range values {
+		if child, ok := value.(configValues); ok {
+			resolvePaths(child, dir)
+			continue
+		}
+		path, ok := value.(string)
+		if key == "promptFile" && ok && path != "" && !filepath.IsAbs(path) {
+			values[key] = filepath.Join(dir, path)
+		}
+	}
+}
+
+// mergeFile merges the config file as a layer
+// If the file is not required, it is skipped if it does not exist
+// Unknown keys and invalid types are recorded as problems with their positions
+func (l *configLayers) mergeFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		l.files = append(l.files, configFile{path: path})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	l.files = append(l.files, configFile{path: path, found: true})
+
+	problems, err := checkSchema(data)
+	if err != nil {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	for _, problem := range problems {
+		l.problems = append(l.problems, fmt.Errorf("%s:%d:%d: %w", path, problem.line, problem.column, &problem.configError))
+	}
+
+	values := configValues{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	// Prompt files are relative to the config file
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	resolvePaths(values, dir)
+	l.merge(l.values, values, "", path)
+	return nil
+}
+
+// set sets the value of the key path as a layer
+func (l *configLayers) set(path []string, value interface{}, source string) {
+	l.merge(l.values, nestedValues(path, value), "", source)
+}
+
+// nestedValues returns the nested maps which have the value at the key path
+func nestedValues(path []string, value interface{}) configValues {
+	values := configValues{}
+	leaf := values
+	for _, key := range path[:len(path)-1] {
+		child := configValues{}
+		leaf[key] = child
+		leaf = child
+	}
+	leaf[path[len(path)-1]] = value
+	return values
+}
+
+// merge merges src into dst recursively and records the sources of the leaves
+func (l *configLayers) merge(dst, src configValues, prefix, source string) {
+	for key, value := range src {
+		path := fmt.Sprint(key)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		srcMap, srcIsMap := value.(configValues)
+		dstMap, dstIsMap := dst[key].(configValues)
+		if srcIsMap {
+			if !dstIsMap {
+				l.forget(path)
+				dstMap = configValues{}
+				dst[key] = dstMap
+			}
+			l.merge(dstMap, srcMap, path, source)
+			continue
+		}
+		l.forget(path)
+		dst[key] = value
+		l.sources[path] = source
+	}
+}
+
+// forget removes the sources of the key and its descendants which are replaced
+func (l *configLayers) forget(path string) {
+	for key := range l.sources {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(l.sources, key)
+		}
+	}
+}
+
+// lookup returns the map of the key path if any
+func (l *configLayers) lookup(path ...string) (configValues, bool) {
+	values := l.values
+	for _, key := range path {
+		child, ok := values[key].(configValues)
+		if !ok {
+			return nil, false
+		}
+		values = child
+	}
+	return values, true
+}
+
+// decode decodes the merged values into Config and validates it
+// All the problems are reported, and the ones of the merged values are annotated with their sources
+func (l *configLayers) decode() (*Config, error) {
+	if len(l.problems) > 0 {
+		return nil, fmt.Errorf("invalid config:\n%w", errors.Join(l.problems...))
+	}
+
+	data, err := yaml.Marshal(l.values)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	config.readPromptFiles()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", l.annotate(err))
+	}
+	return &config, nil
+}
+
+// annotate adds the sources of the values to the joined config errors
+func (l *configLayers) annotate(err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return err
+	}
+	errs := []error{}
+	for _, err := range joined.Unwrap() {
+		var configErr *configError
+		if errors.As(err, &configErr) {
+			if source, ok := l.sources[configErr.key]; ok {
+				err = fmt.Errorf("%w (set in %s)", err, source)
+			}
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// entries returns the leaves of the config with their sources in order of keys
+func (l *configLayers) entries() []configEntry {
+	entries := []configEntry{}
+	var walk func(values configValues, prefix string)
+	walk = func(values configValues, prefix string) {
+		for key, value := range values {
+			path := fmt.Sprint(key)
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			if child, ok := value.(configValues); ok {
+				walk(child, path)
+				continue
+			}
+			entries = append(entries, configEntry{key: path, value: value, source: l.sources[path]})
+		}
+	}
+	walk(l.values, "")
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	return entries
+}
+
+// printSources prints the config files looked up and the values with their sources
+func (l *configLayers) printSources(w io.Writer) error {
+	fmt.Fprintln(w, "Config files (lowest priority first):")
+	for _, file := range l.files {
+		status := ""
+		if !file.found {
+			status = " (not found)"
+		}
+		fmt.Fprintf(w, "  %s%s\n", file.path, status)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, entry := range l.entries() {
+		value, err := json.Marshal(toJSONValue(entry.value))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.key, value, entry.source)
+	}
+	return tw.Flush()
+}
+
+// toJSONValue converts YAML values which cannot be marshaled to JSON
+// Non-finite numbers are shown as in YAML, e.g. .nan
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return ".nan"
+		case math.IsInf(v, 1):
+			return ".inf"
+		case math.IsInf(v, -1):
+			return "-.inf"
+		}
+		return v
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = toJSONValue(item)
+		}
+		return values
+	case configValues:
+		values := map[string]interface{}{}
+		for key, item := range v {
+			values[fmt.Sprint(key)] = toJSONValue(item)
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// findProjectConfig finds the project config file walking up from dir
+func findProjectConfig(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, projectConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// mergeEnv merges GOCHAT_* environment variables as layers
+// The variable names are the upper snake case of the keys, e.g. GOCHAT_COMMANDS_CHAT_TEMPERATURE,
+// and the values are parsed as YAML, e.g. GOCHAT_COMMANDS_CHAT_SYSTEM_MESSAGES='["Be brief"]'
+func (l *configLayers) mergeEnv() error {
+	paths := [][]string{}
+	for _, path := range keyPaths(reflect.TypeOf(Config{})) {
+		if len(path) < 2 || path[1] != "*" {
+			paths = append(paths, path)
+			continue
+		}
+		names := l.mapKeys(path[0])
+		if path[0] == "commands" {
+			names = l.commandNames()
+		}
+		for _, name := range names {
+			paths = append(paths, append([]string{path[0], name}, path[2:]...))
+		}
+	}
+
+	if value, ok := os.LookupEnv(envModel); ok {
+		if err := l.setEnv(envModel, []string{"defaults", "model"}, value); err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		name := envName(path)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := l.setEnv(name, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setEnv sets the value of the environment variable parsed as YAML
+// Invalid types are recorded as problems in the same way as config files
+func (l *configLayers) setEnv(name string, path []string, value string) error {
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	l.set(path, parsed, "$"+name)
+
+	data, err := yaml.Marshal(nestedValues(path, parsed))
+	if err != nil {
+		return err
+	}
+	problems, err := checkSchema(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	for _, problem := range problems {
+		l.problems = append(l.problems, fmt.Errorf("$%s: %w", name, &problem.configError))
+	}
+	return nil
+}
+
+// commandNames returns the built-in commands and the commands in the config
+func (l *configLayers) commandNames() []string {
+	names := append([]string{}, builtinCommands...)
+	for _, name := range l.mapKeys("commands") {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapKeys returns the keys of the map of the key in order
+func (l *configLayers) mapKeys(key string) []string {
+	values, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(values))
+	for key := range values {
+		names = append(names, fmt.Sprint(key))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyPaths returns the key paths of the scalar and list values in the type
+// Map values are represented with '*' key, and profiles are excluded
+func keyPaths(t reflect.Type) [][]string {
+	paths := [][]string{}
+	for name, fieldType := range yamlFields(t) {
+		if name == "profiles" {
+			continue
+		}
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			for _, path := range keyPaths(fieldType) {
+				paths = append(paths, append([]string{name}, path...))
+			}
+		case reflect.Map:
+			for _, path := range keyPaths(fieldType.Elem()) {
+				paths = append(paths, append([]string{name, "*"}, path...))
+			}
+		default:
+			paths = append(paths, []string{name})
+		}
+	}
+	return paths
+}
+
+// envName returns the environment variable name of the key path
+func envName(path []string) string {
+	words := make([]string, 0, len(path))
+	for _, key := range path {
+		words = append(words, upperSnakeCase(key))
+	}
+	return envPrefix + strings.Join(words, "_")
+}
+
+// upperSnakeCase converts camel case to upper snake case, e.g. maxTokens to MAX_TOKENS
+func upperSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes the content to the file creating its directory
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chdir changes the working directory during the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// isolateConfig makes the user config and the project config empty during the test
+// It returns the user config file, and the working directory is a new directory
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	chdir(t, t.TempDir())
+	return filepath.Join(home, ".config", "gochat", "config.yml")
+}
+
+func TestOptions_loadLayers(t *testing.T) {
+	// config.yml next to the executable is the one next to the test binary
+	exec, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	execFile := filepath.Join(filepath.Dir(exec), configFileName)
+	if _, err := os.Stat(execFile); err == nil {
+		t.Skipf("%s exists", execFile)
+	}
+	writeFile(t, execFile, "defaults:\n  temperature: 0.1\n  topP: 0.1\n  maxTokens: 10\n  presencePenalty: 0.1\n"+
+		"request:\n  maxAttempts: 2\n")
+	t.Cleanup(func() {
+		os.Remove(execFile)
+	})
+
+	userFile := isolateConfig(t)
+	writeFile(t, userFile, "defaults:\n  topP: 0.2\n  maxTokens: 20\n  presencePenalty: 0.2\nrequest:\n  maxAttempts: 3\n")
+
+	// The project config is found in the parent directory
+	project, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectFile := filepath.Join(project, projectConfigFileName)
+	writeFile(t, projectFile, "defaults:\n  maxTokens: 30\n  presencePenalty: 0.3\nrequest:\n  maxAttempts: 4\n")
+	if err := os.MkdirAll(filepath.Join(project, "src", "app"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, filepath.Join(project, "src", "app"))
+
+	flagFile := filepath.Join(t.TempDir(), "gochat.yml")
+	writeFile(t, flagFile, "defaults:\n  presencePenalty: 0.4\nrequest:\n  maxAttempts: 5\n")
+
+	t.Setenv("GOCHAT_REQUEST_MAX_ATTEMPTS", "6")
+	t.Setenv("GOCHAT_COMMANDS_CHAT_TEMPERATURE", "0.6")
+	t.Setenv("GOCHAT_MODEL", "gpt-4-32k")
+
+	opts := &options{configFile: flagFile, model: "gpt-4", noStream: true}
+	layers, err := opts.loadLayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := []configFile{
+		{path: execFile, found: true},
+		{path: userFile, found: true},
+		{path: projectFile, found: true},
+		{path: flagFile, found: true},
+	}
+	if !reflect.DeepEqual(layers.files, wantFiles) {
+		t.Errorf("files = %+v, want %+v", layers.files, wantFiles)
+	}
+
+	// want are the values and their sources by keys
+	want := map[string][2]string{
+		"defaults.temperature":         {"0.1", execFile},
+		"defaults.topP":                {"0.2", userFile},
+		"defaults.maxTokens":           {"30", projectFile},
+		"defaults.presencePenalty":     {"0.4", flagFile},
+		"request.maxAttempts":          {"6", "$GOCHAT_REQUEST_MAX_ATTEMPTS"},
+		"commands.chat.temperature":    {"0.6", "$GOCHAT_COMMANDS_CHAT_TEMPERATURE"},
+		"commands.testgen.temperature": {"0", sourceBuiltin},
+		"request.maxBackoff":           {"30s", sourceBuiltin},
+		"defaults.model":               {"gpt-4", "--model"},
+		"commands.chat.model":          {"gpt-4", "--model"},
+		"commands.chat.stream":         {"false", "--no-stream"},
+	}
+	got := map[string][2]string{}
+	for _, entry := range layers.entries() {
+		got[entry.key] = [2]string{fmt.Sprint(entry.value), entry.source}
+	}
+	for key, want := range want {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q", key, got[key], want)
+		}
+	}
+
+	cfg, err := layers.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Request.MaxAttempts != 6 || *cfg.Defaults.PresencePenalty != 0.4 || cfg.Defaults.MaxTokens != 30 {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestOptions_loadLayers_notFound(t *testing.T) {
+	userFile := isolateConfig(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := (&options{}).loadLayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]bool{}
+	for _, file := range layers.files {
+		files[file.path] = file.found
+	}
+	// The project config is looked up in the working directory if no parent has one
+	for _, path := range []string{userFile, filepath.Join(wd, projectConfigFileName)} {
+		if found, ok := files[path]; !ok || found {
+			t.Errorf("files = %+v, want %s not found", layers.files, path)
+		}
+	}
+
+	_, err = (&options{configFile: filepath.Join(wd, "missing.yml")}).loadLayers()
+	if err == nil {
+		t.Errorf("loadLayers() error = nil, want the error of the missing --config")
+	}
+}
+
+func TestOptions_loadLayers_customModel(t *testing.T) {
+	userFile := isolateConfig(t)
+	writeFile(t, userFile, "models:\n  llama-2-13b-chat:\n    contextSize: 4096\n")
+
+	layers, err := (&options{model: "llama-2-13b-chat"}).loadLayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := layers.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Defaults.Model != "llama-2-13b-chat" {
+		t.Errorf("defaults.model = %q, want the custom model", cfg.Defaults.Model)
+	}
+
+	if _, err := (&options{model: "llama-2-70b-chat"}).loadLayers(); err == nil {
+		t.Errorf("loadLayers() error = nil, want the error of the undeclared model")
+	}
+}
+
+func TestOptions_loadLayers_modelOverridesPersonas(t *testing.T) {
+	userFile := isolateConfig(t)
+	writeFile(t, userFile, "personas:\n  reviewer:\n    model: gpt-4\n  poet:\n    temperature: 1\n")
+
+	layers, err := (&options{model: "gpt-3.5-turbo"}).loadLayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := layers.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, persona := range cfg.PersonaNames() {
+		chatConfig, err := cfg.ChatConfig(persona)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chatConfig.Params.Model != "gpt-3.5-turbo" {
+			t.Errorf("model of %s = %q, want the model of --model", persona, chatConfig.Params.Model)
+		}
+	}
+}
+
+func TestConfigLayers_mergeEnv(t *testing.T) {
+	isolateConfig(t)
+	tests := []struct {
+		name string
+		// config is the config file merged before the environment variables
+		config string
+		env    map[string]string
+		// want are the values by keys in YAML
+		want map[string]string
+		// wantProblems are the problems of the values
+		wantProblems []string
+	}{
+		{
+			name: "keys in upper snake case",
+			env: map[string]string{
+				"GOCHAT_DEFAULTS_TOP_P":                "0.5",
+				"GOCHAT_REQUEST_FIRST_TOKEN_TIMEOUT":   "10s",
+				"GOCHAT_COMMANDS_CHAT_SYSTEM_MESSAGES": `["Be brief"]`,
+				"GOCHAT_COMMANDS_CHAT_STREAM":          "false",
+				"GOCHAT_COMMANDS_FINDBUGS_MAX_TOKENS":  "100",
+				"GOCHAT_COMMANDS_TESTGEN_PROMPT_FILE":  "testgen.tmpl",
+				"GOCHAT_MODEL":                         "gpt-4",
+				"GOCHAT_COMMANDS_CHAT_SYSTEM_MESSAGE":  "unknown keys are ignored",
+			},
+			want: map[string]string{
+				"defaults.topP":                "0.5",
+				"request.firstTokenTimeout":    "10s",
+				"commands.chat.systemMessages": "[Be brief]",
+				"commands.chat.stream":         "false",
+				"commands.findbugs.maxTokens":  "100",
+				"commands.testgen.promptFile":  "testgen.tmpl",
+				"defaults.model":               "gpt-4",
+				"commands.chat.systemMessage":  "",
+			},
+		},
+		{
+			name:   "map keys in the config",
+			config: "commands:\n  explain:\n    prompt: Explain {{.Code}}\npersonas:\n  reviewer:\n    temperature: 0\nmodels:\n  llama:\n    contextSize: 2048\n",
+			env: map[string]string{
+				"GOCHAT_COMMANDS_EXPLAIN_TEMPERATURE":  "0.2",
+				"GOCHAT_PERSONAS_REVIEWER_TEMPERATURE": "0.7",
+				"GOCHAT_PERSONAS_WRITER_TEMPERATURE":   "0.9",
+				"GOCHAT_MODELS_LLAMA_CONTEXT_SIZE":     "4096",
+			},
+			want: map[string]string{
+				"commands.explain.temperature":  "0.2",
+				"personas.reviewer.temperature": "0.7",
+				"personas.writer.temperature":   "",
+				"models.llama.contextSize":      "4096",
+			},
+		},
+		{
+			name: "invalid values",
+			env: map[string]string{
+				"GOCHAT_DEFAULTS_TOP_P":       "high",
+				"GOCHAT_DEFAULTS_TEMPERATURE": ".nan",
+				"GOCHAT_REQUEST_MAX_ATTEMPTS": "3.5",
+				"GOCHAT_COMMANDS_CHAT_STREAM": "maybe",
+			},
+			wantProblems: []string{
+				"$GOCHAT_DEFAULTS_TOP_P: defaults.topP: must be a number",
+				"$GOCHAT_DEFAULTS_TEMPERATURE: defaults.temperature: must be a finite number",
+				"$GOCHAT_COMMANDS_CHAT_STREAM: commands.chat.stream: must be a boolean",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			layers := newConfigLayers()
+			if tt.config != "" {
+				if err := layers.mergeYAML("config.yml", []byte(tt.config)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := layers.mergeEnv(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]string{}
+			for _, entry := range layers.entries() {
+				if strings.HasPrefix(entry.source, "$") {
+					got[entry.key] = fmt.Sprint(entry.value)
+					want := "$" + envName(strings.Split(entry.key, "."))
+					if entry.key == "defaults.model" {
+						want = "$" + envModel
+					}
+					if entry.source != want {
+						t.Errorf("source of %s = %s, want %s", entry.key, entry.source, want)
+					}
+				}
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %q, want %q", key, got[key], want)
+				}
+			}
+			problems := []string{}
+			for _, problem := range layers.problems {
+				problems = append(problems, problem.Error())
+			}
+			for _, want := range tt.wantProblems {
+				found := false
+				for _, problem := range problems {
+					found = found || strings.Contains(problem, want)
+				}
+				if !found {
+					t.Errorf("problems = %q, want %q", problems, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{path: []string{"defaults", "model"}, want: "GOCHAT_DEFAULTS_MODEL"},
+		{path: []string{"commands", "chat", "systemMessages"}, want: "GOCHAT_COMMANDS_CHAT_SYSTEM_MESSAGES"},
+		{path: []string{"request", "firstTokenTimeout"}, want: "GOCHAT_REQUEST_FIRST_TOKEN_TIMEOUT"},
+		{path: []string{"defaults", "topP"}, want: "GOCHAT_DEFAULTS_TOP_P"},
+	}
+	for _, tt := range tests {
+		if got := envName(tt.path); got != tt.want {
+			t.Errorf("envName(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConfigLayers_printSources(t *testing.T) {
+	userFile := isolateConfig(t)
+	writeFile(t, userFile, "defaults:\n  model: gpt-4\n  temperature: .nan\n")
+	t.Setenv("GOCHAT_COMMANDS_CHAT_TEMPERATURE", "0.2")
+
+	layers, err := (&options{}).loadLayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := layers.printSources(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Config files (lowest priority first):\n",
+		"  " + userFile + "\n",
+		"/" + projectConfigFileName + " (not found)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// wantRows are the key, the value and the source of the rows
+	wantRows := [][]string{
+		{"defaults.model", `"gpt-4"`, userFile},
+		{"defaults.temperature", `".nan"`, userFile},
+		{"commands.chat.temperature", "0.2", "$GOCHAT_COMMANDS_CHAT_TEMPERATURE"},
+		{"commands.testgen.temperature", "0", sourceBuiltin},
+	}
+	rows := [][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	for _, want := range wantRows {
+		found := false
+		for _, row := range rows {
+			found = found || reflect.DeepEqual(row, want)
+		}
+		if !found {
+			t.Errorf("output does not have the row %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestToJSONValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "number", value: 0.5, want: `0.5`},
+		{name: "NaN", value: math.NaN(), want: `".nan"`},
+		{name: "infinity", value: math.Inf(1), want: `".inf"`},
+		{name: "negative infinity", value: math.Inf(-1), want: `"-.inf"`},
+		{name: "list", value: []interface{}{"a", math.NaN()}, want: `["a",".nan"]`},
+		{name: "map", value: configValues{"temperature": math.NaN(), "topP": 1.0}, want: `{"temperature":".nan","topP":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(toJSONValue(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("toJSONValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
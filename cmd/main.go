@@ -1,70 +1,37 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/chzyer/readline"
 	"github.com/joho/godotenv"
 	"github.com/sashabaranov/go-openai"
 	"github.com/sota0121/go-ai-chat/application"
 	"github.com/sota0121/go-ai-chat/internal"
 	"golang.org/x/exp/slog"
-	yaml "gopkg.in/yaml.v2"
 )
 
-type Config struct {
-	Commands map[string]Command `yaml:"commands"`
-}
-
-type Command struct {
-	SystemMessages []string `yaml:"systemMessages"`
-	UserMessages   []string `yaml:"userMessages"`
-}
-
 const (
-	envFileName         = ".env"
-	configFileName      = "config.yml"
-	openAiApiKeyEnvName = "OPENAI_API_KEY"
-	keyCommandsChat     = "chat"
+	envFileName          = ".env"
+	configFileName       = "config.yml"
+	openAiApiKeyEnvName  = "OPENAI_API_KEY"
+	openAiBaseURLEnvName = "OPENAI_BASE_URL"
 )
 
 func main() {
-	// Load .env file
-	exec, err := os.Executable()
-	if err != nil {
-		slog.Error("Error getting executable path", err)
-		os.Exit(1)
-	}
-	err = loadEnv(filepath.Join(filepath.Dir(exec), envFileName))
-	if err != nil {
+	// Errors are printed by the command
+	if err := newRootCommand().Execute(); err != nil {
 		os.Exit(1)
 	}
-
-	// Load config file
-	cfg, err := loadConfig(filepath.Join(filepath.Dir(exec), configFileName))
-	if err != nil {
-		os.Exit(1)
-	}
-
-	// Create OpenAI client
-	openaiClient, err := createOpenAIClient()
-	if err != nil {
-		os.Exit(1)
-	}
-
-	// Create application
-	ctx := context.Background()
-	ctx = internal.SetOpenAIClientToContext(ctx, openaiClient)
-	app := NewApp(ctx, cfg)
-
-	// Start chat application
-	app.Execute()
 }
 
 // loadEnv loads .env file
@@ -75,108 +42,287 @@ func loadEnv(fileName string) error {
 		if os.IsNotExist(err) {
 			return nil
 		}
-		slog.Info("Error loading .env file")
-		return err
+		return fmt.Errorf("loading %s: %w", fileName, err)
 	}
 	return nil
 }
 
-// loadConfig loads config file
-func loadConfig(fileName string) (*Config, error) {
-	yamlFile, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		slog.Error("yamlFile.Get err   #%v ", err)
-		return nil, err
-	}
-
-	var config Config
-
-	err = yaml.Unmarshal(yamlFile, &config)
-	if err != nil {
-		slog.Error("Unmarshal: %v", err)
-		return nil, err
-	}
-	return &config, nil
-}
-
 // createOpenAIClient creates OpenAI client
-func createOpenAIClient() (*openai.Client, error) {
+// Failed requests are retried according to the request config
+func createOpenAIClient(requestConfig RequestConfig) (*openai.Client, error) {
 	// Get OpenAI API Key
 	openaiApiKey := os.Getenv(openAiApiKeyEnvName)
 	if openaiApiKey == "" {
-		slog.Info("OpenAI API Key is not set")
 		return nil, errors.New("OpenAI API Key is not set")
 	}
 
-	// Display OpenAI API Key
-	hiddenApiKey := openaiApiKey[:4] + strings.Repeat("*", len(openaiApiKey)-4)
-	fmt.Println("OpenAI API Key: ", hiddenApiKey)
+	// Use OpenAI compatible server if base URL is set
+	config := openai.DefaultConfig(openaiApiKey)
+	if baseURL := os.Getenv(openAiBaseURLEnvName); baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = &http.Client{
+		Transport: internal.NewRetryTransport(http.DefaultTransport, requestConfig.RetryPolicy()),
+	}
 
 	// Create OpenAI client only once
-	openaiClient := openai.NewClient(openaiApiKey)
+	openaiClient := openai.NewClientWithConfig(config)
 	return openaiClient, nil
 }
 
+// printOpenAIConfig displays OpenAI API Key with masking and the base URL if set
+func printOpenAIConfig() {
+	openaiApiKey := os.Getenv(openAiApiKeyEnvName)
+	hiddenApiKey := openaiApiKey[:4] + strings.Repeat("*", len(openaiApiKey)-4)
+	fmt.Println("OpenAI API Key: ", hiddenApiKey)
+	if baseURL := os.Getenv(openAiBaseURLEnvName); baseURL != "" {
+		fmt.Println("OpenAI Base URL: ", baseURL)
+	}
+}
+
 type App struct {
-	ctx            context.Context
+	ctx      context.Context
+	provider internal.Provider
+	// mu is held while the input is executed so that the config is not reloaded in the middle
+	mu             sync.Mutex
 	config         *Config
+	persona        string
+	input          *inputReader
 	CommandService application.CommandService
 	ChatService    application.ChatService
 	FindBugService application.FindBugService
 	TestGenService application.TestGenService
+	// customCommands are the names of the custom commands registered to CommandService
+	customCommands []string
+	// configFiles are the config files watched by watcher with the prompt files
+	configFiles []string
+	watcher     internal.FileWatcher
 }
 
-func NewApp(ctx context.Context, cfg *Config) *App {
-	systemMessages := cfg.Commands[keyCommandsChat].SystemMessages
-	userMessages := cfg.Commands[keyCommandsChat].UserMessages
+func NewApp(ctx context.Context, cfg *Config, provider internal.Provider, persona string) (*App, error) {
+	chatService, err := newChatService(cfg, persona, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	findBugService, testGenService, err := newCodeServices(cfg, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	customCommands, err := cfg.CustomCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	commandService := application.NewCommandService()
+	lines, err := newLineReader(commandService)
+	if err != nil {
+		slog.Error("Error creating line reader", err)
+		return nil, err
+	}
 
-	return &App{
+	app := &App{
 		ctx:            ctx,
+		provider:       provider,
 		config:         cfg,
-		CommandService: application.NewCommandService(),
-		ChatService:    application.NewChatService(systemMessages, userMessages),
-		FindBugService: application.NewFindBugService(),
-		TestGenService: application.NewTestGenService(),
+		persona:        persona,
+		input:          newInputReader(lines),
+		CommandService: commandService,
+		ChatService:    chatService,
+		FindBugService: findBugService,
+		TestGenService: testGenService,
+	}
+	if err := app.registerCommands(); err != nil {
+		return nil, err
+	}
+	if err := app.setCustomCommands(customCommands); err != nil {
+		return nil, err
 	}
+	return app, nil
+}
+
+// newCodeServices creates FindBugService and TestGenService with the command configs
+func newCodeServices(cfg *Config, provider internal.Provider) (application.FindBugService, application.TestGenService, error) {
+	findBugsPrompt, err := cfg.PromptTemplate(keyCommandsFindBugs)
+	if err != nil {
+		return nil, nil, err
+	}
+	testGenPrompt, err := cfg.PromptTemplate(keyCommandsTestGen)
+	if err != nil {
+		return nil, nil, err
+	}
+	return application.NewFindBugService(provider, cfg.ModelParams(keyCommandsFindBugs), findBugsPrompt),
+		application.NewTestGenService(provider, cfg.ModelParams(keyCommandsTestGen), testGenPrompt),
+		nil
+}
+
+// newChatService creates ChatService with the chat command config and the persona
+func newChatService(cfg *Config, persona string, provider internal.Provider) (application.ChatService, error) {
+	chatConfig, err := cfg.ChatConfig(persona)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizer, err := internal.NewTokenizer(chatConfig.Params.Model)
+	if err != nil {
+		slog.Error("Error creating tokenizer", err)
+		return nil, err
+	}
+
+	sessionDir, err := internal.DefaultSessionDir()
+	if err != nil {
+		slog.Error("Error getting session directory", err)
+		return nil, err
+	}
+	store := internal.NewFileSessionStore(sessionDir)
+
+	return application.NewChatService(provider, tokenizer, store, chatConfig), nil
 }
 
 // Execute executes application
 func (a *App) Execute() error {
+	defer a.input.Close()
 	fmt.Println("Please input text (or ':quit' to exit): ")
 
+	// Ctrl-C cancels the running request instead of terminating the process
+	interrupts := newInterruptHandler(func() {
+		fmt.Println("Bye!")
+		a.input.Close()
+		os.Exit(0)
+	})
+	interrupts.Start()
+	defer interrupts.Stop()
+
 	// Process loop
 	for {
-		fmt.Printf("chat> ")
-		s := bufio.NewScanner(os.Stdin)
-		s.Scan()
-
-		// Parse command
-		if strings.HasPrefix(s.Text(), ":") {
-			ct := a.CommandService.ParseCommand(s.Text())
-			switch ct {
-			case application.ShowHelp:
-				a.CommandService.ShowHelp()
-			case application.ShowVersion:
-				a.CommandService.ShowVersion()
-			case application.Quit:
+		text, multiLine, err := a.input.ReadInput("chat> ")
+		if errors.Is(err, io.EOF) {
+			fmt.Println("Bye!")
+			return nil
+		}
+		if errors.Is(err, errInterrupted) {
+			if interrupts.Interrupt() {
 				fmt.Println("Bye!")
 				return nil
-			case application.TestGen:
-				err := a.TestGenService.SendRequestStream(a.ctx, s.Text())
-				if err != nil {
-					slog.Error("Error TestGenService.SendRequestStream", err)
-					break
-				}
-			case application.FindBugs:
-				err := a.FindBugService.SendRequestStream(a.ctx, s.Text())
-				if err != nil {
-					slog.Error("Error FindBugService.SendRequestStream", err)
-					break
-				}
 			}
 			continue
 		}
-		a.ChatService.SendTextStream(a.ctx, s.Text())
-		// a.ChatService.SendText(a.ctx, s.Text())
+		if err != nil {
+			slog.Error("Error reading input", err)
+			return err
+		}
+		interrupts.Reset()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		ctx, cancel := interrupts.WithCancel(a.ctx)
+		a.mu.Lock()
+		quit := a.executeInput(ctx, text, multiLine)
+		a.mu.Unlock()
+		cancel()
+		if quit {
+			fmt.Println("Bye!")
+			return nil
+		}
+	}
+}
+
+// executeInput executes the command or sends the text to the chat
+// This returns true if the user wants to quit
+func (a *App) executeInput(ctx context.Context, text string, multiLine bool) bool {
+	if multiLine || !strings.HasPrefix(text, ":") {
+		printError(a.ChatService.Send(ctx, text))
+		return false
+	}
+
+	err := a.CommandService.Execute(ctx, text)
+	var argsErr *application.ArgsError
+	switch {
+	case errors.Is(err, application.ErrQuit):
+		return true
+	case errors.Is(err, application.ErrUnknownCommand), errors.As(err, &argsErr):
+		fmt.Println(err)
+	default:
+		printError(err)
+	}
+	return false
+}
+
+// printError prints the error of the input once in the same form as the one-shot commands
+// Canceled requests are not errors since they are already reported
+func printError(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	fmt.Printf("Error: %v\n", err)
+}
+
+// editMessage edits the message and resends it
+// The message is the latest one or the one of '#<id>'
+// If text has no new message, this asks for it showing the message
+func (a *App) editMessage(ctx context.Context, args application.Args) error {
+	text := args.Raw
+
+	id := 0
+	if strings.HasPrefix(text, "#") {
+		idText, rest, _ := strings.Cut(text[1:], " ")
+		n, err := strconv.Atoi(idText)
+		if err != nil {
+			return &application.ArgsError{Err: fmt.Errorf("invalid message id %q", idText)}
+		}
+		id = n
+		text = strings.TrimSpace(rest)
+	}
+
+	edited := text
+	if edited == "" {
+		var original string
+		var err error
+		if id == 0 {
+			original, err = a.ChatService.LastUserMessage()
+		} else {
+			original, err = a.ChatService.UserMessage(id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Message: %s\n", original)
+		edited, _, err = a.input.ReadInputWithDefault("edit> ", original)
+		if errors.Is(err, errInterrupted) {
+			edited = ""
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		edited = strings.TrimSpace(edited)
+	}
+	if edited == "" {
+		fmt.Println("Canceled")
+		return nil
+	}
+
+	if id == 0 {
+		return a.ChatService.EditLastMessage(ctx, edited)
+	}
+	return a.ChatService.EditMessage(ctx, id, edited)
+}
+
+// newLineReader creates lineReader for the standard input
+// Line editing is enabled only if the standard input is a terminal
+func newLineReader(commandService application.CommandService) (lineReader, error) {
+	if !readline.DefaultIsTerminal() {
+		return newBufferedLineReader(os.Stdin), nil
+	}
+
+	// Input history is optional, so continue without it on error
+	historyFile, err := internal.DefaultInputHistoryFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(historyFile), 0o700)
+	}
+	if err != nil {
+		slog.Info("Input history is disabled", err)
+		historyFile = ""
 	}
+	return newReadlineLineReader(historyFile, commandService)
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/sota0121/go-ai-chat/application"
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// askCommandName is the name of the command to ask a question once
+const askCommandName = "ask"
+
+// answerOutput is the answer of one-shot commands in JSON output format
+type answerOutput struct {
+	Command string `json:"command"`
+	Model   string `json:"model"`
+	Answer  string `json:"answer"`
+}
+
+// runAsk asks the question once and writes the answer to the standard output
+// The answer has no decoration so that it can be used in scripts
+func runAsk(ctx context.Context, opts *options, args []string) error {
+	text, err := askText(args, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	cfg, provider, err := opts.setup()
+	if err != nil {
+		return err
+	}
+	// The persona may override the model of the chat command
+	chatConfig, err := cfg.ChatConfig(opts.persona)
+	if err != nil {
+		return err
+	}
+	chatService, err := newChatService(cfg, opts.persona, provider)
+	if err != nil {
+		return err
+	}
+	return writeAnswer(opts, askCommandName, chatConfig.Params.Model, func(w io.Writer) error {
+		return chatService.Ask(ctx, text, w)
+	})
+}
+
+// runCode runs findbugs or testgen once for the file and the optional function of the request
+func runCode(ctx context.Context, opts *options, command string, req application.CodeRequest) error {
+	cfg, provider, err := opts.setup()
+	if err != nil {
+		return err
+	}
+	findBugService, testGenService, err := newCodeServices(cfg, provider)
+	if err != nil {
+		return err
+	}
+	return writeAnswer(opts, command, cfg.ModelParams(command).Model, func(w io.Writer) error {
+		if command == keyCommandsFindBugs {
+			return findBugService.FindBugs(ctx, req, w)
+		}
+		return testGenService.GenerateTest(ctx, req, w)
+	})
+}
+
+// runCustom runs the custom command in the config once with the arguments
+func runCustom(ctx context.Context, opts *options, args []string) error {
+	cfg, provider, err := opts.setup()
+	if err != nil {
+		return err
+	}
+	commands, err := cfg.CustomCommands()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(commands))
+	for _, command := range commands {
+		if command.Name != args[0] {
+			names = append(names, command.Name)
+			continue
+		}
+		commandArgs, err := application.ParseArgs(command.Args, nil, args[1:])
+		if err != nil {
+			return &application.ArgsError{Usage: fmt.Sprintf("gochat run %s %s", command.Name, command.Usage()), Err: err}
+		}
+		return writeAnswer(opts, command.Name, command.Params.Model, func(w io.Writer) error {
+			return application.NewCustomCommandService(provider, command).Run(ctx, commandArgs, w)
+		})
+	}
+	return fmt.Errorf("unknown custom command %q%s", args[0], internal.DidYouMean(args[0], names))
+}
+
+// runSessions lists saved sessions
+func runSessions(opts *options) error {
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+	// Listing sessions does not send any request, so no provider is needed
+	chatService, err := newChatService(cfg, defaultPersona, nil)
+	if err != nil {
+		return err
+	}
+
+	if opts.outputFormat != outputFormatJSON {
+		return chatService.ListSessions()
+	}
+	sessions, err := chatService.Sessions()
+	if err != nil {
+		return err
+	}
+	return writeJSON(sessions)
+}
+
+// writeAnswer writes the answer as is, or as JSON after the answer is completed
+func writeAnswer(opts *options, command, model string, answer func(w io.Writer) error) error {
+	if opts.outputFormat != outputFormatJSON {
+		return answer(os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	if err := answer(&buf); err != nil {
+		return err
+	}
+	return writeJSON(answerOutput{
+		Command: command,
+		Model:   model,
+		Answer:  strings.TrimSuffix(buf.String(), "\n"),
+	})
+}
+
+// writeJSON writes v to the standard output as indented JSON
+func writeJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// askText returns the question from the arguments and the standard input
+// The standard input is read unless it is a terminal, e.g. `git diff | gochat ask "review this"`
+func askText(args []string, stdin *os.File) (string, error) {
+	question := strings.Join(args, " ")
+	if readline.IsTerminal(int(stdin.Fd())) {
+		if question == "" {
+			return "", errors.New("question is required")
+		}
+		return question, nil
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading standard input: %w", err)
+	}
+	content := strings.TrimRight(string(input), "\n")
+	switch {
+	case question == "" && content == "":
+		return "", errors.New("question is required")
+	case question == "":
+		return content, nil
+	case content == "":
+		return question, nil
+	default:
+		return question + "\n\n" + content, nil
+	}
+}
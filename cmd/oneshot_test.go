@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+// captureStdout redirects the standard output to a file during the test and returns the function to read it
+func captureStdout(t *testing.T) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		f.Close()
+	})
+	return func() string {
+		out, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+}
+
+func TestRunAsk_jsonModel(t *testing.T) {
+	isolateConfig(t)
+	configFile := filepath.Join(t.TempDir(), "persona.yml")
+	writeFile(t, configFile, `
+commands:
+  chat:
+    model: gpt-3.5-turbo
+personas:
+  reviewer:
+    model: gpt-4
+`)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		persona string
+		want    string
+	}{
+		{name: "chat command", persona: defaultPersona, want: "gpt-3.5-turbo"},
+		{name: "persona", persona: "reviewer", want: "gpt-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeopenai.NewServer(fakeopenai.Response{Content: "Hi!"})
+			t.Cleanup(srv.Close)
+			t.Setenv(openAiApiKeyEnvName, "sk-test")
+			t.Setenv(openAiBaseURLEnvName, srv.BaseURL())
+			stdout := captureStdout(t)
+
+			opts := &options{configFile: configFile, persona: tt.persona, outputFormat: outputFormatJSON}
+			if err := runAsk(context.Background(), opts, []string{"Hello"}); err != nil {
+				t.Fatalf("runAsk() error = %v", err)
+			}
+
+			var got answerOutput
+			if err := json.Unmarshal([]byte(stdout()), &got); err != nil {
+				t.Fatalf("output is not JSON: %v", err)
+			}
+			want := answerOutput{Command: askCommandName, Model: tt.want, Answer: "Hi!"}
+			if got != want {
+				t.Errorf("output = %+v, want %+v", got, want)
+			}
+			if requests := srv.Requests(); len(requests) != 1 || requests[0].Model != tt.want {
+				t.Errorf("requests = %+v, want one to %s", requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestAskText(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "question",
+			args: []string{"what", "is", "go?"},
+			want: "what is go?",
+		},
+		{
+			name:  "piped input",
+			stdin: "diff --git a/main.go b/main.go\n\n",
+			want:  "diff --git a/main.go b/main.go",
+		},
+		{
+			name:  "question and piped input",
+			args:  []string{"review this"},
+			stdin: "diff --git a/main.go b/main.go\n",
+			want:  "review this\n\ndiff --git a/main.go b/main.go",
+		},
+		{
+			name:    "no question",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stdin")
+			if err := os.WriteFile(path, []byte(tt.stdin), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			stdin, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+
+			got, err := askText(tt.args, stdin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("askText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("askText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// switchPersona applies the persona to the chat
+// The conversation is kept unless fresh is true
+func (a *App) switchPersona(name string, fresh bool) error {
+	chatConfig, err := a.config.ChatConfig(name)
+	if err != nil {
+		return err
+	}
+	if err := a.ChatService.Reconfigure(chatConfig); err != nil {
+		return err
+	}
+	a.persona = name
+	if fresh {
+		a.ChatService.Reset()
+		fmt.Printf("Switched to the persona %s with a new conversation\n", name)
+		return nil
+	}
+	fmt.Printf("Switched to the persona %s\n", name)
+	return nil
+}
+
+// listPersonas prints the personas with their models, marking the current one with '*'
+func (a *App) listPersonas() {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range a.config.PersonaNames() {
+		mark := " "
+		if name == a.persona {
+			mark = "*"
+		}
+		description := "chat command config"
+		if persona, ok := a.config.Personas[name]; ok {
+			description = persona.Description
+		}
+		// The persona is valid since the config is validated
+		chatConfig, _ := a.config.ChatConfig(name)
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\n", mark, name, chatConfig.Params.Model, description)
+	}
+	tw.Flush()
+}
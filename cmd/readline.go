@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/chzyer/readline"
+	"github.com/sota0121/go-ai-chat/application"
+)
+
+// newReadlineLineReader creates lineReader with line editing, input history and completion
+// Input history is saved to historyFile across runs if it is not empty
+func newReadlineLineReader(historyFile string, commandService application.CommandService) (lineReader, error) {
+	rl, err := readline.NewEx(&readline.Config{
+		HistoryFile:       historyFile,
+		HistorySearchFold: true,
+		AutoComplete:      &commandCompleter{commandService: commandService},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &readlineLineReader{
+		rl: rl,
+	}, nil
+}
+
+type readlineLineReader struct {
+	rl *readline.Instance
+}
+
+var _ lineReader = (*readlineLineReader)(nil)
+
+// ReadLine prints the prompt and reads a line with line editing
+// Ctrl-C discards the line being edited and returns errInterrupted
+func (r *readlineLineReader) ReadLine(prompt string) (string, error) {
+	return r.ReadLineWithDefault(prompt, "")
+}
+
+// ReadLineWithDefault reads a line starting with the default text to be edited
+func (r *readlineLineReader) ReadLineWithDefault(prompt, defaultText string) (string, error) {
+	r.rl.SetPrompt(prompt)
+	line, err := r.rl.ReadlineWithDefault(defaultText)
+	if errors.Is(err, readline.ErrInterrupt) {
+		return "", errInterrupted
+	}
+	return line, err
+}
+
+// Stdout returns the writer which redraws the prompt after the output
+func (r *readlineLineReader) Stdout() io.Writer {
+	return r.rl.Stdout()
+}
+
+// Close restores the terminal
+func (r *readlineLineReader) Close() error {
+	return r.rl.Close()
+}
+
+// commandCompleter completes commands and their arguments with CommandService
+type commandCompleter struct {
+	commandService application.CommandService
+}
+
+var _ readline.AutoCompleter = (*commandCompleter)(nil)
+
+// Do returns the suffixes of candidates and the length of the word being completed
+func (c *commandCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	word := []rune(text)
+	for i := len(word) - 1; i >= 0; i-- {
+		if word[i] == ' ' {
+			word = word[i+1:]
+			break
+		}
+	}
+
+	candidates := c.commandService.Complete(text)
+	suffixes := make([][]rune, 0, len(candidates))
+	for _, candidate := range candidates {
+		suffix := []rune(candidate)[len(word):]
+		// Add a space to continue to the next argument unless it is a directory or an option taking a value
+		if len(suffix) == 0 || (suffix[len(suffix)-1] != '/' && suffix[len(suffix)-1] != '=') {
+			suffix = append(suffix, ' ')
+		}
+		suffixes = append(suffixes, suffix)
+	}
+	return suffixes, len(word)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sota0121/go-ai-chat/internal"
+)
+
+// watchConfig reloads the config when any of the config files or the prompt files is changed while the chat is running
+func (a *App) watchConfig(opts *options) (internal.FileWatcher, error) {
+	layers, err := opts.loadLayers()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(layers.files))
+	for _, file := range layers.files {
+		files = append(files, file.path)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.configFiles = files
+	watcher, err := internal.NewFileWatcher(a.watchedFiles(a.config), func() {
+		a.reloadConfig(opts.loadConfig)
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.watcher = watcher
+	return watcher, nil
+}
+
+// watchedFiles returns the config files and the prompt files of the config
+func (a *App) watchedFiles(cfg *Config) []string {
+	return append(append([]string{}, a.configFiles...), cfg.PromptFiles()...)
+}
+
+// reloadConfig loads the config and applies it to the running services
+// The current config is kept if the new one is invalid
+// The config is compared with the contents of the prompt files, so that the changes of the prompt templates are applied
+func (a *App) reloadConfig(load func() (*Config, error)) {
+	cfg, err := load()
+	if err != nil {
+		fmt.Fprintf(a.input.Stdout(), "The config was not reloaded, keeping the current one: %v\n", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if reflect.DeepEqual(cfg, a.config) {
+		return
+	}
+	if err := a.applyConfig(cfg); err != nil {
+		// The custom models of the current config are restored
+		internal.SetCustomModels(a.config.ContextSizes())
+		fmt.Fprintf(a.input.Stdout(), "The config was not reloaded, keeping the current one: %v\n", err)
+		return
+	}
+	fmt.Fprintln(a.input.Stdout(), "Reloaded the config")
+
+	// The prompt files may be added or removed
+	if a.watcher != nil {
+		if err := a.watcher.SetFiles(a.watchedFiles(cfg)); err != nil {
+			fmt.Fprintf(a.input.Stdout(), "The prompt files are not watched: %v\n", err)
+		}
+	}
+}
+
+// applyConfig applies the messages, models, parameters, prompt templates and custom commands to the services
+// The request settings take effect after restart since the client is shared
+func (a *App) applyConfig(cfg *Config) error {
+	chatConfig, err := cfg.ChatConfig(a.persona)
+	if err != nil {
+		return err
+	}
+	findBugService, testGenService, err := newCodeServices(cfg, a.provider)
+	if err != nil {
+		return err
+	}
+	customCommands, err := cfg.CustomCommands()
+	if err != nil {
+		return err
+	}
+	if err := a.ChatService.Reconfigure(chatConfig); err != nil {
+		return err
+	}
+	if err := a.setCustomCommands(customCommands); err != nil {
+		return err
+	}
+	if cfg.Request != a.config.Request {
+		fmt.Fprintln(a.input.Stdout(), "The request settings take effect after restart")
+	}
+	a.FindBugService = findBugService
+	a.TestGenService = testGenService
+	a.config = cfg
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sota0121/go-ai-chat/internal"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// builtinCommands are the commands which can be configured in commands besides custom commands
+var builtinCommands = []string{keyCommandsChat, keyCommandsFindBugs, keyCommandsTestGen}
+
+// configError is a problem of the config value of the key
+type configError struct {
+	key string
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.key + ": " + e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// schemaError is a problem of the config found at the position in the YAML document
+type schemaError struct {
+	line, column int
+	configError
+}
+
+// checkSchema checks the keys and the types of the YAML document against Config
+// Unlike decoding, it reports all the problems with their positions
+func checkSchema(data []byte) ([]schemaError, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return checkNode(doc.Content[0], reflect.TypeOf(Config{}), ""), nil
+}
+
+// checkNode checks the node against the type recursively
+func checkNode(node *yaml.Node, t reflect.Type, key string) []schemaError {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return nil
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return []schemaError{newSchemaError(node, key, errors.New("must be a map"))}
+		}
+		fields := yamlFields(t)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		problems := []schemaError{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, keyNode.Value)
+			fieldType, ok := fields[keyNode.Value]
+			if !ok {
+				err := fmt.Errorf("unknown key%s", internal.DidYouMean(keyNode.Value, names))
+				problems = append(problems, newSchemaError(keyNode, childKey, err))
+				continue
+			}
+			problems = append(problems, checkNode(valueNode, fieldType, childKey)...)
+		}
+		return problems
+
+	case t.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return []schemaError{newSchemaError(node, key, errors.New("must be a map"))}
+		}
+		problems := []schemaError{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, keyNode.Value)
+			problems = append(problems, checkNode(valueNode, t.Elem(), childKey)...)
+		}
+		return problems
+
+	default:
+		// Values are decoded in the same way as loading the config
+		value := reflect.New(t)
+		if err := node.Decode(value.Interface()); err != nil {
+			return []schemaError{newSchemaError(node, key, fmt.Errorf("must be %s", typeName(t)))}
+		}
+		// .nan and .inf are numbers in YAML, but none of the parameters accepts them
+		if v := value.Elem(); v.CanFloat() && (math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0)) {
+			return []schemaError{newSchemaError(node, key, errors.New("must be a finite number"))}
+		}
+		return nil
+	}
+}
+
+func newSchemaError(node *yaml.Node, key string, err error) schemaError {
+	return schemaError{
+		line:        node.Line,
+		column:      node.Column,
+		configError: configError{key: key, err: err},
+	}
+}
+
+// yamlFields returns the types of the fields of the struct by YAML keys
+// Fields of inline structs are flattened, and unexported fields are skipped
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for name, fieldType := range yamlFields(field.Type) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// typeName describes the type of config values in error messages
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "a duration, e.g. 30s or 5m"
+	case t.Kind() == reflect.Bool:
+		return "a boolean"
+	case t.Kind() == reflect.Int:
+		return "an integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "a number"
+	case t.Kind() == reflect.String:
+		return "a string"
+	case t.Kind() == reflect.Slice:
+		return "a list of " + strings.TrimPrefix(strings.TrimPrefix(typeName(t.Elem()), "an "), "a ") + "s"
+	default:
+		return t.String()
+	}
+}
+
+// joinKey joins the key to the parent key with '.'
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
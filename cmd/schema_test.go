@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		// want are the problems formatted as line:column: key: message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			yaml: "defaults:\n  model: gpt-4\n  temperature: 0.5\n  stop: [\"\\n\"]\n" +
+				"commands:\n  chat:\n    systemMessages:\n      - You are a bot\n    stream: false\n" +
+				"request:\n  timeout: 30s\n",
+			want: []string{},
+		},
+		{
+			name: "empty document",
+			yaml: "",
+			want: nil,
+		},
+		{
+			name: "null values",
+			yaml: "defaults:\ncommands:\n  chat: ~\n",
+			want: []string{},
+		},
+		{
+			name: "unknown key",
+			yaml: "defaults:\n  model: gpt-4\ncommands:\n  chat:\n    systemMessage: You are a bot\n",
+			want: []string{`5:5: commands.chat.systemMessage: unknown key (did you mean "systemMessages"?)`},
+		},
+		{
+			name: "unknown top-level key",
+			yaml: "default:\n  model: gpt-4\n",
+			want: []string{`1:1: default: unknown key (did you mean "defaults"?)`},
+		},
+		{
+			name: "unknown key without suggestion",
+			yaml: "request:\n  proxy: http://localhost\n",
+			want: []string{"2:3: request.proxy: unknown key"},
+		},
+		{
+			name: "wrong types",
+			yaml: "defaults:\n  temperature: high\n  maxTokens: many\n" +
+				"commands:\n  chat:\n    stream: maybe\n    systemMessages: You are a bot\n" +
+				"request:\n  timeout: 5\n",
+			want: []string{
+				"2:16: defaults.temperature: must be a number",
+				"3:14: defaults.maxTokens: must be an integer",
+				"6:13: commands.chat.stream: must be a boolean",
+				"7:21: commands.chat.systemMessages: must be a list of strings",
+				"9:12: request.timeout: must be a duration, e.g. 30s or 5m",
+			},
+		},
+		{
+			name: "non-finite numbers",
+			yaml: "defaults:\n  temperature: .nan\n  topP: .inf\n  presencePenalty: -.inf\n",
+			want: []string{
+				"2:16: defaults.temperature: must be a finite number",
+				"3:9: defaults.topP: must be a finite number",
+				"4:20: defaults.presencePenalty: must be a finite number",
+			},
+		},
+		{
+			name: "not a map",
+			yaml: "defaults: gpt-4\ncommands:\n  - chat\n",
+			want: []string{
+				"1:11: defaults: must be a map",
+				"3:3: commands: must be a map",
+			},
+		},
+		{
+			name: "map values",
+			yaml: "personas:\n  reviewer:\n    temperature: 0\n    systemMessage: Review\n  writer: text\n",
+			want: []string{
+				`4:5: personas.reviewer.systemMessage: unknown key (did you mean "systemMessages"?)`,
+				"5:11: personas.writer: must be a map",
+			},
+		},
+		{
+			name: "alias",
+			yaml: "defaults: &defaults\n  temperature: zero\nprofiles:\n  low:\n    defaults: *defaults\n",
+			want: []string{
+				"2:16: defaults.temperature: must be a number",
+				"2:16: profiles.low.defaults.temperature: must be a number",
+			},
+		},
+		{
+			name:    "invalid YAML",
+			yaml:    "defaults:\n  model: [gpt-4\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := checkSchema([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			if problems != nil {
+				got = []string{}
+			}
+			for _, problem := range problems {
+				got = append(got, fmt.Sprintf("%d:%d: %v", problem.line, problem.column, &problem.configError))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkSchema() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNode(t *testing.T) {
+	type nested struct {
+		Values []int `yaml:"values"`
+	}
+	type Inline struct {
+		Name string `yaml:"name"`
+	}
+	type sample struct {
+		Inline  `yaml:",inline"`
+		Nested  *nested           `yaml:"nested"`
+		Labels  map[string]string `yaml:"labels"`
+		ignored string
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		key  string
+		want []string
+	}{
+		{
+			name: "inline field",
+			yaml: "name: gochat\n",
+			want: []string{},
+		},
+		{
+			name: "unexported field",
+			yaml: "ignored: true\n",
+			want: []string{`1:1: ignored: unknown key`},
+		},
+		{
+			name: "pointer to struct",
+			yaml: "nested:\n  values: [1, two]\n",
+			want: []string{"2:11: nested.values: must be a list of integers"},
+		},
+		{
+			name: "map of strings",
+			yaml: "labels:\n  a: x\n  b: [y]\n",
+			want: []string{"3:6: labels.b: must be a string"},
+		},
+		{
+			name: "parent key",
+			yaml: "nam: gochat\n",
+			key:  "sample",
+			want: []string{`1:1: sample.nam: unknown key (did you mean "name"?)`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, problem := range checkNode(doc.Content[0], reflect.TypeOf(sample{}), tt.key) {
+				got = append(got, fmt.Sprintf("%d:%d: %v", problem.line, problem.column, &problem.configError))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkNode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package fakeopenai provides an in-process server which speaks
+// OpenAI compatible chat completion API with scripted responses.
+// This is intended to be used in tests and for offline development.
+package fakeopenai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	chatCompletionsPath = "/v1/chat/completions"
+)
+
+// Response is a scripted response returned by Server
+type Response struct {
+	// Content is the content of the assistant message
+	Content string
+	// Tokens are sent one by one in stream mode
+	// If empty, Content is sent as a single token
+	Tokens []string
+	// StatusCode is the HTTP status code; 200 is used if zero
+	// Non 2xx status codes are sent with OpenAI style error body
+	StatusCode int
+	// Header is added to the HTTP response
+	Header http.Header
+	// Delay is the wait before the response, and before each token in stream mode
+	Delay time.Duration
+	// Release, if set, gates the response in the same places as Delay
+	// The server waits for a value from Release each time, so that tests can
+	// control exactly how many tokens are sent without relying on timing
+	Release <-chan struct{}
+}
+
+// Server is a fake OpenAI API server
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []openai.ChatCompletionRequest
+}
+
+// NewServer starts a fake server which returns responses in order
+func NewServer(responses ...Response) *Server {
+	s := &Server{
+		responses: responses,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(chatCompletionsPath, s.handleChatCompletions)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// BaseURL returns base URL to be set to OpenAI client config
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Enqueue appends responses to be returned
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns requests received so far
+func (s *Server) Requests() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]openai.ChatCompletionRequest, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// handleChatCompletions handles /v1/chat/completions
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, ok := s.next(req)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "no scripted response left")
+		return
+	}
+
+	for key, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if res.StatusCode != 0 && (res.StatusCode < 200 || res.StatusCode >= 300) {
+		writeError(w, res.StatusCode, res.Content)
+		return
+	}
+
+	if req.Stream {
+		writeStream(w, r, req.Model, res)
+		return
+	}
+	if !wait(r, res) {
+		return
+	}
+	writeCompletion(w, req.Model, res)
+}
+
+// next records the request and pops next scripted response
+func (s *Server) next(req openai.ChatCompletionRequest) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if len(s.responses) == 0 {
+		return Response{}, false
+	}
+	res := s.responses[0]
+	s.responses = s.responses[1:]
+	return res, true
+}
+
+// writeCompletion writes non stream chat completion response
+func writeCompletion(w http.ResponseWriter, model string, res Response) {
+	content := res.Content
+	if content == "" {
+		content = strings.Join(res.Tokens, "")
+	}
+
+	body := openai.ChatCompletionResponse{
+		ID:      "chatcmpl-fake",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index: 0,
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: content,
+				},
+				FinishReason: "stop",
+			},
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeStream writes chat completion response as server-sent events
+func writeStream(w http.ResponseWriter, r *http.Request, model string, res Response) {
+	tokens := res.Tokens
+	if len(tokens) == 0 {
+		tokens = []string{res.Content}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for _, token := range tokens {
+		if !wait(r, res) {
+			return
+		}
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-fake",
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{
+					Index: 0,
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						Content: token,
+					},
+				},
+			},
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// wait waits for the release and the delay of the response
+// This returns false if the client has gone away
+func wait(r *http.Request, res Response) bool {
+	if res.Release != nil {
+		select {
+		case <-res.Release:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	if res.Delay <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(res.Delay):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// writeError writes OpenAI style error response
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	body := openai.ErrorResponse{
+		Error: &openai.APIError{
+			Message: message,
+			Type:    "fake_error",
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// knownModels are the chat models which can be requested
+// The value is the context size of the model in tokens
+var knownModels = map[string]int{
+	openai.GPT3Dot5Turbo:     4096,
+	openai.GPT3Dot5Turbo0301: 4096,
+	openai.GPT4:              8192,
+	openai.GPT40314:          8192,
+	openai.GPT432K:           32768,
+	openai.GPT432K0314:       32768,
+}
+
+// customModels are the models declared in the config, e.g. the ones of OpenAI compatible servers
+// The value is the context size of the model in tokens
+var (
+	customModelsMu sync.RWMutex
+	customModels   = map[string]int{}
+)
+
+const (
+	// defaultContextSize is used for models whose context size is unknown
+	defaultContextSize = 4096
+)
+
+// ModelParams is the model and sampling parameters of a request
+// Nil or zero values are left to the provider defaults
+type ModelParams struct {
+	Model            string
+	Temperature      *float32
+	TopP             *float32
+	MaxTokens        int
+	Stop             []string
+	PresencePenalty  *float32
+	FrequencyPenalty *float32
+}
+
+// ParamError is the error of the parameter out of its range
+type ParamError struct {
+	Param  string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return e.Param + " " + e.Reason
+}
+
+// ValidateModel checks if the model is a known chat model or a custom model set by SetCustomModels
+func ValidateModel(model string) error {
+	return ValidateModelWith(model, customModelSizes())
+}
+
+// ValidateModelWith checks if the model is a known chat model or one of the custom models
+// The custom models are given by their context sizes in tokens
+func ValidateModelWith(model string, custom map[string]int) error {
+	if strings.TrimSpace(model) == "" {
+		return errors.New("model must not be empty")
+	}
+	if _, ok := knownModels[model]; ok {
+		return nil
+	}
+	if _, ok := custom[model]; ok {
+		return nil
+	}
+	models := modelNames(custom)
+	return fmt.Errorf("unknown model %q%s: must be one of %s, or declared in models of the config", model, DidYouMean(model, models), strings.Join(models, ", "))
+}
+
+// SetCustomModels replaces the custom models with the ones declared in the config
+// The value is the context size of the model in tokens
+func SetCustomModels(models map[string]int) {
+	custom := make(map[string]int, len(models))
+	for model, size := range models {
+		custom[model] = size
+	}
+	customModelsMu.Lock()
+	defer customModelsMu.Unlock()
+	customModels = custom
+}
+
+// customModelSizes returns the context sizes of the custom models
+func customModelSizes() map[string]int {
+	customModelsMu.RLock()
+	defer customModelsMu.RUnlock()
+	return customModels
+}
+
+// KnownModels returns the names of known chat models and custom models
+func KnownModels() []string {
+	return modelNames(customModelSizes())
+}
+
+// modelNames returns the names of known chat models and the custom models in order
+func modelNames(custom map[string]int) []string {
+	models := make([]string, 0, len(knownModels)+len(custom))
+	for model := range knownModels {
+		models = append(models, model)
+	}
+	for model := range custom {
+		if _, ok := knownModels[model]; !ok {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// ContextSize returns the context size of the model in tokens
+// The sizes of custom models take precedence over the known ones
+func ContextSize(model string) int {
+	if size, ok := customModelSizes()[model]; ok {
+		return size
+	}
+	if size, ok := knownModels[model]; ok {
+		return size
+	}
+	return defaultContextSize
+}
+
+// Validate validates ranges of sampling parameters
+// Model name is validated separately by ValidateModel
+func (p ModelParams) Validate() error {
+	if err := validateRange("temperature", p.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := validateRange("topP", p.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := validateRange("presencePenalty", p.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := validateRange("frequencyPenalty", p.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if p.MaxTokens < 0 {
+		return &ParamError{Param: "maxTokens", Reason: "must not be negative"}
+	}
+	if len(p.Stop) > 4 {
+		return &ParamError{Param: "stop", Reason: "must have at most 4 sequences"}
+	}
+	return nil
+}
+
+// validateRange checks if optional value is in [min, max]
+// NaN and infinities are rejected explicitly since NaN is not ordered
+func validateRange(name string, v *float32, min, max float32) error {
+	if v == nil {
+		return nil
+	}
+	if f := float64(*v); math.IsNaN(f) || math.IsInf(f, 0) {
+		return &ParamError{Param: name, Reason: "must be a finite number"}
+	}
+	if *v < min || *v > max {
+		return &ParamError{Param: name, Reason: fmt.Sprintf("must be between %v and %v", min, max)}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestValidateModelWith(t *testing.T) {
+	custom := map[string]int{"llama-2-13b-chat": 4096}
+	tests := []struct {
+		model string
+		// wantErr is contained in the error message, or no error is expected if empty
+		wantErr string
+	}{
+		{model: "gpt-4"},
+		{model: "llama-2-13b-chat"},
+		{model: "gpt4", wantErr: `unknown model "gpt4" (did you mean "gpt-4"?)`},
+		{model: "llama-2-13-chat", wantErr: `(did you mean "llama-2-13b-chat"?)`},
+		{model: " ", wantErr: "must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			err := ValidateModelWith(tt.model, custom)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateModelWith() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateModelWith() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetCustomModels(t *testing.T) {
+	SetCustomModels(map[string]int{"llama-2-13b-chat": 2048, openai.GPT4: 16384})
+	t.Cleanup(func() {
+		SetCustomModels(nil)
+	})
+
+	if err := ValidateModel("llama-2-13b-chat"); err != nil {
+		t.Errorf("ValidateModel() error = %v", err)
+	}
+	if models := KnownModels(); !strings.Contains(strings.Join(models, ","), "llama-2-13b-chat") {
+		t.Errorf("KnownModels() = %v, want the custom model", models)
+	}
+	sizes := map[string]int{
+		"llama-2-13b-chat":   2048,
+		openai.GPT4:          16384,
+		openai.GPT3Dot5Turbo: 4096,
+		"unknown":            defaultContextSize,
+	}
+	for model, want := range sizes {
+		if got := ContextSize(model); got != want {
+			t.Errorf("ContextSize(%q) = %d, want %d", model, got, want)
+		}
+	}
+
+	SetCustomModels(nil)
+	if err := ValidateModel("llama-2-13b-chat"); err == nil {
+		t.Errorf("ValidateModel() error = nil after the custom models are cleared")
+	}
+}
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+func TestModelParams_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ModelParams
+		// wantParam is the parameter of ParamError, or no error is expected if empty
+		wantParam string
+	}{
+		{
+			name:   "unset",
+			params: ModelParams{},
+		},
+		{
+			name:   "bounds",
+			params: ModelParams{Temperature: float32Ptr(2), TopP: float32Ptr(0), PresencePenalty: float32Ptr(-2), FrequencyPenalty: float32Ptr(2)},
+		},
+		{
+			name:      "out of range",
+			params:    ModelParams{Temperature: float32Ptr(2.5)},
+			wantParam: "temperature",
+		},
+		{
+			name:      "NaN",
+			params:    ModelParams{TopP: float32Ptr(float32(math.NaN()))},
+			wantParam: "topP",
+		},
+		{
+			name:      "positive infinity",
+			params:    ModelParams{PresencePenalty: float32Ptr(float32(math.Inf(1)))},
+			wantParam: "presencePenalty",
+		},
+		{
+			name:      "negative infinity",
+			params:    ModelParams{FrequencyPenalty: float32Ptr(float32(math.Inf(-1)))},
+			wantParam: "frequencyPenalty",
+		},
+		{
+			name:      "negative max tokens",
+			params:    ModelParams{MaxTokens: -1},
+			wantParam: "maxTokens",
+		},
+		{
+			name:      "too many stop sequences",
+			params:    ModelParams{Stop: []string{"a", "b", "c", "d", "e"}},
+			wantParam: "stop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if tt.wantParam == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			var paramErr *ParamError
+			if !errors.As(err, &paramErr) || paramErr.Param != tt.wantParam {
+				t.Errorf("Validate() error = %v, want error of %s", err, tt.wantParam)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"math"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultModel is the model used when a request does not specify one
+	DefaultModel = openai.GPT3Dot5Turbo
+)
+
+// NewOpenAIProvider creates Provider backed by OpenAI API
+func NewOpenAIProvider(client *openai.Client) Provider {
+	return &openAIProvider{
+		client: client,
+	}
+}
+
+type openAIProvider struct {
+	client *openai.Client
+}
+
+var _ Provider = (*openAIProvider)(nil)
+
+// CreateChatCompletion creates chat completion
+func (p *openAIProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	response, err := p.client.CreateChatCompletion(ctx, p.toOpenAIRequest(req))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if len(response.Choices) == 0 {
+		return ChatResponse{}, ErrNoChoices
+	}
+
+	msg := response.Choices[0].Message
+	return ChatResponse{
+		Message: Message{
+			Role:    msg.Role,
+			Content: msg.Content,
+		},
+	}, nil
+}
+
+// CreateChatCompletionStream creates chat completion in stream
+func (p *openAIProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (TokenStream, error) {
+	openaiReq := p.toOpenAIRequest(req)
+	openaiReq.Stream = true
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, openaiReq)
+	if err != nil {
+		return nil, err
+	}
+	return &openAITokenStream{stream: stream}, nil
+}
+
+// toOpenAIRequest converts ChatRequest to OpenAI request
+func (p *openAIProvider) toOpenAIRequest(req ChatRequest) openai.ChatCompletionRequest {
+	model := req.Model
+	if model == "" {
+		model = DefaultModel
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:            model,
+		Messages:         messages,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      toOpenAIFloat(req.Temperature),
+		TopP:             toOpenAIFloat(req.TopP),
+		Stop:             req.Stop,
+		PresencePenalty:  toOpenAIFloat(req.PresencePenalty),
+		FrequencyPenalty: toOpenAIFloat(req.FrequencyPenalty),
+	}
+}
+
+// toOpenAIFloat converts optional parameter to OpenAI request value
+// go-openai tags the float parameters with omitempty, so an explicit zero would be dropped from the request
+// and the API default, e.g. temperature 1, would be used instead, which breaks the reproducible output of testgen
+// An explicit zero is sent as math.SmallestNonzeroFloat32, which is kept in the request and behaves the same as zero,
+// while unset parameters are still omitted
+func toOpenAIFloat(v *float32) float32 {
+	if v == nil {
+		return 0
+	}
+	if *v == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return *v
+}
+
+type openAITokenStream struct {
+	stream *openai.ChatCompletionStream
+}
+
+var _ TokenStream = (*openAITokenStream)(nil)
+
+// Recv receives next token
+// Responses without any choice are skipped
+func (s *openAITokenStream) Recv() (string, error) {
+	for {
+		response, err := s.stream.Recv()
+		if err != nil {
+			return "", err
+		}
+		if len(response.Choices) == 0 {
+			continue
+		}
+		return response.Choices[0].Delta.Content, nil
+	}
+}
+
+// Close closes the stream
+func (s *openAITokenStream) Close() error {
+	s.stream.Close()
+	return nil
+}
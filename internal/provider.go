@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"errors"
+)
+
+// Chat message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+var (
+	// ErrNoChoices is returned when a provider responds without any choice
+	ErrNoChoices = errors.New("no choices")
+)
+
+// Message is a chat message exchanged with a provider
+type Message struct {
+	Role    string
+	Content string
+}
+
+// ChatRequest is a provider independent chat completion request
+type ChatRequest struct {
+	ModelParams
+	Messages []Message
+}
+
+// ChatResponse is a provider independent chat completion response
+type ChatResponse struct {
+	Message Message
+}
+
+// TokenStream is a stream of generated tokens
+// Recv returns io.EOF when the stream is finished
+type TokenStream interface {
+	Recv() (string, error)
+	Close() error
+}
+
+// Provider is a LLM backend which serves chat completions
+type Provider interface {
+	CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error)
+	CreateChatCompletionStream(ctx context.Context, req ChatRequest) (TokenStream, error)
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+	// defaultJitter is the ratio of the backoff to be randomized
+	defaultJitter = 0.2
+)
+
+// RetryPolicy is the policy of retrying failed requests
+// Zero values fall back to the defaults
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, which is doubled for every retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum wait before a retry
+	MaxBackoff time.Duration
+}
+
+// withDefaults returns the policy whose unset values are replaced with the defaults
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	return p
+}
+
+// Validate validates the policy
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("maxAttempts must not be negative: %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	return nil
+}
+
+// backoff returns the wait before the retry of the attempt with jitter
+// attempt starts from 1 for the first retry
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff *= 1 - defaultJitter + 2*defaultJitter*rand.Float64()
+	return time.Duration(backoff)
+}
+
+// NewRetryTransport creates http.RoundTripper which retries requests
+// on rate limit (429), server errors (5xx) and network errors with exponential backoff
+// Retry-After header of the response is honored if it is longer than the backoff
+func NewRetryTransport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{
+		base:   base,
+		policy: policy.withDefaults(),
+	}
+}
+
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+var _ http.RoundTripper = (*retryTransport)(nil)
+
+// RoundTrip sends the request and retries it while it is retryable
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := t.base.RoundTrip(req)
+		if attempt >= t.policy.MaxAttempts || !isRetryable(req.Context(), res, err) {
+			return res, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			// The body has been consumed and cannot be sent again
+			return res, err
+		}
+
+		wait := t.policy.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(res); ok && retryAfter > wait {
+			wait = retryAfter
+		}
+		slog.Info("Retrying request", "attempt", attempt+1, "wait", wait.Round(time.Millisecond), "reason", retryReason(res, err))
+		if res != nil {
+			// Drain the body to reuse the connection
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// isRetryable returns true if the request failed temporarily
+func isRetryable(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// retryReason returns the reason of the retry to be logged
+func retryReason(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return res.Status
+}
+
+// parseRetryAfter parses Retry-After header in seconds or HTTP date
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+const testRequestBody = `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"Hi"}]}`
+
+// newTestRequest creates chat completion request to the fake server
+func newTestRequest(t *testing.T, ctx context.Context, srv *fakeopenai.Server) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.BaseURL()+"/chat/completions", strings.NewReader(testRequestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 3, want: 400 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 10, want: time.Second},
+	}
+	for _, tt := range tests {
+		min := time.Duration(float64(tt.want) * (1 - defaultJitter))
+		max := time.Duration(float64(tt.want) * (1 + defaultJitter))
+		for i := 0; i < 100; i++ {
+			if got := policy.backoff(tt.attempt); got < min || got > max {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, got, min, max)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy_withDefaults(t *testing.T) {
+	got := RetryPolicy{}.withDefaults()
+	want := RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// min and max are the bounds of the wait, as HTTP date has the resolution of seconds
+		min, max time.Duration
+		wantOK   bool
+	}{
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second, wantOK: true},
+		{name: "zero seconds", value: "0", wantOK: true},
+		{name: "HTTP date", value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second, wantOK: true},
+		{name: "past HTTP date", value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), min: -2 * time.Hour, max: 0, wantOK: true},
+		{name: "empty", value: ""},
+		{name: "invalid", value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				res.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := parseRetryAfter(res)
+			if ok != tt.wantOK {
+				t.Fatalf("parseRetryAfter() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter() = %v, want in [%v, %v]", got, tt.min, tt.max)
+			}
+		})
+	}
+
+	if _, ok := parseRetryAfter(nil); ok {
+		t.Error("parseRetryAfter(nil) ok = true, want false")
+	}
+}
+
+func TestRetryTransport_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		responses   []fakeopenai.Response
+		wantStatus  int
+		// wantRequests is the number of requests received by the server
+		wantRequests int
+	}{
+		{
+			name:         "success",
+			maxAttempts:  3,
+			responses:    []fakeopenai.Response{{Content: "Hi!"}},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:        "rate limit",
+			maxAttempts: 3,
+			responses: []fakeopenai.Response{
+				{StatusCode: http.StatusTooManyRequests},
+				{Content: "Hi!"},
+			},
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:        "server errors",
+			maxAttempts: 3,
+			responses: []fakeopenai.Response{
+				{StatusCode: http.StatusInternalServerError},
+				{StatusCode: http.StatusBadGateway},
+				{Content: "Hi!"},
+			},
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+		},
+		{
+			name:        "attempts exhausted",
+			maxAttempts: 2,
+			responses: []fakeopenai.Response{
+				{StatusCode: http.StatusServiceUnavailable},
+				{StatusCode: http.StatusServiceUnavailable},
+				{Content: "Hi!"},
+			},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: 2,
+		},
+		{
+			name:        "bad request",
+			maxAttempts: 3,
+			responses: []fakeopenai.Response{
+				{StatusCode: http.StatusBadRequest},
+				{Content: "Hi!"},
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantRequests: 1,
+		},
+		{
+			name:        "unauthorized",
+			maxAttempts: 3,
+			responses: []fakeopenai.Response{
+				{StatusCode: http.StatusUnauthorized},
+				{Content: "Hi!"},
+			},
+			wantStatus:   http.StatusUnauthorized,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeopenai.NewServer(tt.responses...)
+			t.Cleanup(srv.Close)
+			transport := NewRetryTransport(nil, RetryPolicy{
+				MaxAttempts:    tt.maxAttempts,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			})
+
+			res, err := transport.RoundTrip(newTestRequest(t, context.Background(), srv))
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("RoundTrip() status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			// The server rejects requests whose body cannot be decoded, so
+			// every request counted here carried the whole body
+			if got := len(srv.Requests()); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_RoundTrip_retryAfter(t *testing.T) {
+	srv := fakeopenai.NewServer(
+		fakeopenai.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"1"}},
+		},
+		fakeopenai.Response{Content: "Hi!"},
+	)
+	t.Cleanup(srv.Close)
+	transport := NewRetryTransport(nil, RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+
+	start := time.Now()
+	res, err := transport.RoundTrip(newTestRequest(t, context.Background(), srv))
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("RoundTrip() took %v, want at least the Retry-After of 1s", elapsed)
+	}
+}
+
+func TestRetryTransport_RoundTrip_canceledWhileWaiting(t *testing.T) {
+	srv := fakeopenai.NewServer(
+		fakeopenai.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"3600"}},
+		},
+		fakeopenai.Response{Content: "Hi!"},
+	)
+	t.Cleanup(srv.Close)
+	transport := NewRetryTransport(nil, RetryPolicy{MaxAttempts: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := transport.RoundTrip(newTestRequest(t, ctx, srv))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := len(srv.Requests()); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestRetryTransport_RoundTrip_nonReplayableBody(t *testing.T) {
+	srv := fakeopenai.NewServer(
+		fakeopenai.Response{StatusCode: http.StatusInternalServerError},
+		fakeopenai.Response{Content: "Hi!"},
+	)
+	t.Cleanup(srv.Close)
+	transport := NewRetryTransport(nil, RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+
+	req := newTestRequest(t, context.Background(), srv)
+	req.Body = io.NopCloser(strings.NewReader(testRequestBody))
+	req.GetBody = nil
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("RoundTrip() status = %d, want %d", res.StatusCode, http.StatusInternalServerError)
+	}
+	if got := len(srv.Requests()); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
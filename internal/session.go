@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sessionFileExt = ".json"
+	sessionIDTime  = "20060102-150405"
+	// sessionIDRandomBytes is the length of the random suffix of session IDs
+	// so that sessions created in the same second never overwrite each other
+	sessionIDRandomBytes = 3
+)
+
+var (
+	// ErrSessionNotFound is returned when the session does not exist
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Session is a persisted chat session
+type Session struct {
+	ID             string        `json:"id"`
+	Model          string        `json:"model"`
+	SystemMessages []string      `json:"systemMessages"`
+	UserMessages   []string      `json:"userMessages"`
+	Nodes          []SessionNode `json:"nodes"`
+	CurrentID      int           `json:"currentId"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	UpdatedAt      time.Time     `json:"updatedAt"`
+}
+
+// SessionNode is a message in the conversation tree of a persisted chat session
+// Parents are always stored before their children
+type SessionNode struct {
+	ID       int    `json:"id"`
+	ParentID int    `json:"parentId,omitempty"`
+	Role     string `json:"role"`
+	Content  string `json:"content"`
+	Pinned   bool   `json:"pinned,omitempty"`
+	// Summary is the summary of the messages up to this message
+	Summary string `json:"summary,omitempty"`
+	// Truncated is set when the answer was canceled while receiving it
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// NewSessionID returns an ID of a session created at t with a random suffix, e.g. 20230401-120000-1a2b3c
+func NewSessionID(t time.Time) string {
+	suffix := make([]byte, sessionIDRandomBytes)
+	if _, err := rand.Read(suffix); err != nil {
+		// Fall back to the nanoseconds which are still unlikely to collide
+		return fmt.Sprintf("%s-%09d", t.Format(sessionIDTime), t.Nanosecond())
+	}
+	return t.Format(sessionIDTime) + "-" + hex.EncodeToString(suffix)
+}
+
+// SessionStore persists chat sessions
+type SessionStore interface {
+	Save(session *Session) error
+	Load(id string) (*Session, error)
+	List() ([]*Session, error)
+}
+
+// NewFileSessionStore creates SessionStore which stores sessions as JSON files in dir
+func NewFileSessionStore(dir string) SessionStore {
+	return &fileSessionStore{
+		dir: dir,
+	}
+}
+
+type fileSessionStore struct {
+	dir string
+}
+
+var _ SessionStore = (*fileSessionStore)(nil)
+
+// Save saves the session
+// The file is replaced atomically so that a crash never leaves a broken session
+func (s *fileSessionStore) Save(session *Session) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, session.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(session.ID))
+}
+
+// Load loads the session
+func (s *fileSessionStore) Load(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("broken session %s: %w", id, err)
+	}
+	return &session, nil
+}
+
+// List lists sessions in order of last update
+func (s *fileSessionStore) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != sessionFileExt {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(entry.Name(), sessionFileExt))
+		if err != nil {
+			// Skip broken sessions so that the others can be listed
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// path returns the file path of the session
+func (s *fileSessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+sessionFileExt)
+}
@@ -0,0 +1,69 @@
+package internal
+
+import "strings"
+
+// Suggest returns the candidate closest to name to be suggested for a typo
+// Candidates farther than a third of the name length are not suggested
+// The prefixes of commands and options, ':' and '--', are ignored in the distance
+func Suggest(name string, candidates []string) (string, bool) {
+	name = trimPrefix(name)
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(trimPrefix(candidate)))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, best != ""
+}
+
+// DidYouMean returns the hint of the suggestion, e.g. ` (did you mean "chat"?)`, or empty string
+func DidYouMean(name string, candidates []string) string {
+	if suggestion, ok := Suggest(name, candidates); ok {
+		return ` (did you mean "` + suggestion + `"?)`
+	}
+	return ""
+}
+
+// trimPrefix trims the prefix of commands and options
+func trimPrefix(name string) string {
+	return strings.TrimLeft(name, ":-")
+}
+
+// editDistance returns the optimal string alignment distance between a and b,
+// which counts a transposition of adjacent characters, e.g. "hepl" for "help", as one edit
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] is the distance between s[:i] and t[:j]
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRequestTimeout is returned when a request is not finished within the request timeout
+	ErrRequestTimeout = errors.New("request timed out")
+	// ErrFirstTokenTimeout is returned when no token is received within the first token timeout
+	ErrFirstTokenTimeout = errors.New("no token received within the first token timeout")
+)
+
+// Timeouts are the timeouts of requests
+// Zero values disable the timeouts
+type Timeouts struct {
+	// Request is the timeout of a whole request including retries and receiving the stream
+	Request time.Duration
+	// FirstToken is the timeout to receive the first token of the stream including opening it
+	// It is not applied to non-stream requests, whose responses arrive after the whole answer is generated
+	FirstToken time.Duration
+}
+
+// Validate validates the timeouts
+func (t Timeouts) Validate() error {
+	if t.Request < 0 || t.FirstToken < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	return nil
+}
+
+// NewTimeoutProvider creates Provider which applies the timeouts to the requests of provider
+func NewTimeoutProvider(provider Provider, timeouts Timeouts) Provider {
+	return &timeoutProvider{
+		provider: provider,
+		timeouts: timeouts,
+	}
+}
+
+type timeoutProvider struct {
+	provider Provider
+	timeouts Timeouts
+}
+
+var _ Provider = (*timeoutProvider)(nil)
+
+// CreateChatCompletion creates chat completion within the request timeout
+func (p *timeoutProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	ctx, cancel := p.withRequestTimeout(ctx)
+	defer cancel(nil)
+
+	res, err := p.provider.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return ChatResponse{}, timeoutCause(ctx, err)
+	}
+	return res, nil
+}
+
+// CreateChatCompletionStream creates chat completion stream within the request timeout
+// The stream fails if the first token is not received within the first token timeout after the request is sent
+func (p *timeoutProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (TokenStream, error) {
+	ctx, cancel := p.withRequestTimeout(ctx)
+
+	var firstToken *time.Timer
+	if p.timeouts.FirstToken > 0 {
+		firstToken = time.AfterFunc(p.timeouts.FirstToken, func() {
+			cancel(ErrFirstTokenTimeout)
+		})
+	}
+
+	stream, err := p.provider.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		if firstToken != nil {
+			firstToken.Stop()
+		}
+		cancel(nil)
+		return nil, timeoutCause(ctx, err)
+	}
+
+	return &timeoutTokenStream{
+		stream:     stream,
+		ctx:        ctx,
+		cancel:     cancel,
+		firstToken: firstToken,
+	}, nil
+}
+
+// withRequestTimeout returns the context which is canceled with ErrRequestTimeout
+func (p *timeoutProvider) withRequestTimeout(parent context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if p.timeouts.Request <= 0 {
+		return ctx, cancel
+	}
+	timer := time.AfterFunc(p.timeouts.Request, func() {
+		cancel(ErrRequestTimeout)
+	})
+	return ctx, func(cause error) {
+		timer.Stop()
+		cancel(cause)
+	}
+}
+
+// timeoutCause returns the timeout error if the request failed because of the timeouts
+func timeoutCause(ctx context.Context, err error) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrRequestTimeout) || errors.Is(cause, ErrFirstTokenTimeout) {
+		return cause
+	}
+	return err
+}
+
+type timeoutTokenStream struct {
+	stream     TokenStream
+	ctx        context.Context
+	cancel     context.CancelCauseFunc
+	firstToken *time.Timer
+	once       sync.Once
+}
+
+var _ TokenStream = (*timeoutTokenStream)(nil)
+
+// Recv receives the next token
+// The first token timeout is stopped when a token is received
+func (s *timeoutTokenStream) Recv() (string, error) {
+	token, err := s.stream.Recv()
+	if err != nil {
+		return "", timeoutCause(s.ctx, err)
+	}
+	if s.firstToken != nil {
+		s.once.Do(func() {
+			s.firstToken.Stop()
+		})
+	}
+	return token, nil
+}
+
+// Close closes the stream and releases the timers
+func (s *timeoutTokenStream) Close() error {
+	if s.firstToken != nil {
+		s.firstToken.Stop()
+	}
+	s.cancel(nil)
+	return s.stream.Close()
+}
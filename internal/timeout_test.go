@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sota0121/go-ai-chat/internal/fakeopenai"
+)
+
+// newTestTimeoutProvider starts the fake server with the responses and
+// returns the provider connected to it with the timeouts
+func newTestTimeoutProvider(t *testing.T, timeouts Timeouts, responses ...fakeopenai.Response) Provider {
+	t.Helper()
+	srv := fakeopenai.NewServer(responses...)
+	t.Cleanup(srv.Close)
+
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = srv.BaseURL()
+	config.HTTPClient = &http.Client{}
+	return NewTimeoutProvider(NewOpenAIProvider(openai.NewClientWithConfig(config)), timeouts)
+}
+
+var testChatRequest = ChatRequest{
+	Messages: []Message{{Role: openai.ChatMessageRoleUser, Content: "Hi"}},
+}
+
+func TestTimeouts_Validate(t *testing.T) {
+	if err := (Timeouts{Request: time.Second, FirstToken: time.Second}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := (Timeouts{FirstToken: -time.Second}).Validate(); err == nil {
+		t.Error("Validate() error = nil, want error for negative timeout")
+	}
+}
+
+func TestTimeoutProvider_CreateChatCompletion(t *testing.T) {
+	// never is not released, so the response is held until the client gives up
+	never := make(chan struct{})
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		response fakeopenai.Response
+		wantErr  error
+	}{
+		{
+			name:     "success",
+			timeouts: Timeouts{Request: time.Minute},
+			response: fakeopenai.Response{Content: "Hi!"},
+		},
+		{
+			name:     "request timeout",
+			timeouts: Timeouts{Request: 50 * time.Millisecond},
+			response: fakeopenai.Response{Release: never},
+			wantErr:  ErrRequestTimeout,
+		},
+		{
+			name:     "first token timeout is not applied",
+			timeouts: Timeouts{FirstToken: time.Millisecond},
+			response: fakeopenai.Response{Content: "Hi!", Delay: 50 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestTimeoutProvider(t, tt.timeouts, tt.response)
+			res, err := provider.CreateChatCompletion(context.Background(), testChatRequest)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CreateChatCompletion() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() error = %v", err)
+			}
+			if res.Message.Content != "Hi!" {
+				t.Errorf("CreateChatCompletion() content = %q, want %q", res.Message.Content, "Hi!")
+			}
+		})
+	}
+}
+
+func TestTimeoutProvider_CreateChatCompletionStream_firstTokenTimeout(t *testing.T) {
+	never := make(chan struct{})
+	provider := newTestTimeoutProvider(t, Timeouts{FirstToken: 50 * time.Millisecond},
+		fakeopenai.Response{Tokens: []string{"Hi", "!"}, Release: never},
+	)
+
+	stream, err := provider.CreateChatCompletionStream(context.Background(), testChatRequest)
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+	if _, err := stream.Recv(); !errors.Is(err, ErrFirstTokenTimeout) {
+		t.Errorf("Recv() error = %v, want %v", err, ErrFirstTokenTimeout)
+	}
+}
+
+func TestTimeoutProvider_CreateChatCompletionStream_afterFirstToken(t *testing.T) {
+	firstToken := 20 * time.Millisecond
+	release := make(chan struct{})
+	provider := newTestTimeoutProvider(t, Timeouts{FirstToken: firstToken},
+		fakeopenai.Response{Tokens: []string{"Hi", "!"}, Release: release},
+	)
+
+	stream, err := provider.CreateChatCompletionStream(context.Background(), testChatRequest)
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+
+	release <- struct{}{}
+	if token, err := stream.Recv(); err != nil || token != "Hi" {
+		t.Fatalf("Recv() = %q, %v, want %q", token, err, "Hi")
+	}
+	// The first token timeout would have fired by now if it were still running
+	time.Sleep(5 * firstToken)
+	release <- struct{}{}
+	if token, err := stream.Recv(); err != nil || token != "!" {
+		t.Fatalf("Recv() = %q, %v, want %q", token, err, "!")
+	}
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestTimeoutProvider_CreateChatCompletionStream_canceled(t *testing.T) {
+	never := make(chan struct{})
+	provider := newTestTimeoutProvider(t, Timeouts{Request: time.Minute, FirstToken: time.Minute},
+		fakeopenai.Response{Tokens: []string{"Hi"}, Release: never},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := provider.CreateChatCompletionStream(ctx, testChatRequest)
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+	cancel()
+	_, err = stream.Recv()
+	if err == nil || errors.Is(err, ErrRequestTimeout) || errors.Is(err, ErrFirstTokenTimeout) {
+		t.Errorf("Recv() error = %v, want cancellation which is not a timeout", err)
+	}
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	// fallbackEncoding is used for models tiktoken does not know
+	fallbackEncoding = "cl100k_base"
+
+	// tokensPerMessage is the overhead of each message in chat format
+	tokensPerMessage = 3
+	// tokensPerReply is the overhead to prime the assistant reply
+	tokensPerReply = 3
+)
+
+func init() {
+	// Use embedded BPE files so that counting tokens works offline
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// Tokenizer counts tokens as the model does
+type Tokenizer interface {
+	CountTokens(text string) int
+	CountMessageTokens(messages []Message) int
+}
+
+// NewTokenizer creates Tokenizer for the model
+func NewTokenizer(model string) (Tokenizer, error) {
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(fallbackEncoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &tiktokenTokenizer{
+		encoding: encoding,
+	}, nil
+}
+
+type tiktokenTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var _ Tokenizer = (*tiktokenTokenizer)(nil)
+
+// CountTokens counts tokens of the text
+func (t *tiktokenTokenizer) CountTokens(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// CountMessageTokens counts tokens of the messages sent as a chat request
+// See https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+func (t *tiktokenTokenizer) CountMessageTokens(messages []Message) int {
+	count := tokensPerReply
+	for _, msg := range messages {
+		count += tokensPerMessage
+		count += t.CountTokens(msg.Role)
+		count += t.CountTokens(msg.Content)
+	}
+	return count
+}
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/slog"
+)
+
+// fileWatchDelay is the time to wait for the events to settle
+// Editors often write a file in several steps, e.g. truncate and write, or write to a temporary file and rename
+const fileWatchDelay = 200 * time.Millisecond
+
+// FileWatcher calls the function when any of the watched files is changed
+type FileWatcher interface {
+	SetFiles(paths []string) error
+	Close() error
+}
+
+// NewFileWatcher watches the files which may not exist yet
+// The directories of the files are watched so that files replaced or created by editors are also detected
+// The nearest existing parent of a directory which does not exist is watched until the directory is created
+func NewFileWatcher(paths []string, onChange func()) (FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fileWatcher{
+		watcher:  watcher,
+		files:    map[string]bool{},
+		dirs:     map[string]bool{},
+		pending:  map[string]bool{},
+		onChange: onChange,
+	}
+	if err := w.SetFiles(paths); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+	dirs    map[string]bool
+	// pending are the directories of the files which do not exist yet
+	pending  map[string]bool
+	onChange func()
+	mu       sync.Mutex
+	timer    *time.Timer
+	closed   bool
+}
+
+// SetFiles replaces the watched files with paths
+// The directories already watched are kept watched
+func (w *fileWatcher) SetFiles(paths []string) error {
+	files := map[string]bool{}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		files[abs] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = files
+	_, err := w.watchDirs()
+	return err
+}
+
+// watchDirs watches the directories of the files, and records the ones which do not exist as pending
+// It returns true if any of the files exists in the directories newly watched
+// w.mu must be held
+func (w *fileWatcher) watchDirs() (bool, error) {
+	w.pending = map[string]bool{}
+	found := false
+	for file := range w.files {
+		dir := filepath.Dir(file)
+		if w.dirs[dir] {
+			continue
+		}
+		watched, err := w.watchNearest(dir)
+		if err != nil {
+			return false, err
+		}
+		if watched != dir {
+			w.pending[dir] = true
+			continue
+		}
+		if _, err := os.Stat(file); err == nil {
+			found = true
+		}
+	}
+	return found, nil
+}
+
+// watchNearest watches dir, or its nearest existing parent if dir does not exist, and returns the watched directory
+// w.mu must be held
+func (w *fileWatcher) watchNearest(dir string) (string, error) {
+	for {
+		if w.dirs[dir] {
+			return dir, nil
+		}
+		err := w.watcher.Add(dir)
+		if err == nil {
+			w.dirs[dir] = true
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, os.ErrNotExist) || parent == dir {
+			return "", err
+		}
+		dir = parent
+	}
+}
+
+// awaits returns true if name is a pending directory or one of their parents
+// w.mu must be held
+func (w *fileWatcher) awaits(name string) bool {
+	for dir := range w.pending {
+		if dir == name || strings.HasPrefix(dir, name+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh watches the pending directories when name, which is one of them or their parents, is created
+// onChange is called if the files have been created in the directories before they are watched
+func (w *fileWatcher) refresh(name string) {
+	w.mu.Lock()
+	if !w.awaits(name) {
+		w.mu.Unlock()
+		return
+	}
+	found, err := w.watchDirs()
+	w.mu.Unlock()
+	if err != nil {
+		slog.Error("Error watching directories", err)
+		return
+	}
+	if found {
+		w.schedule()
+	}
+}
+
+var _ FileWatcher = (*fileWatcher)(nil)
+
+// run receives the events until the watcher is closed
+func (w *fileWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				w.refresh(filepath.Clean(event.Name))
+			}
+			if !w.watches(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.schedule()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("Error watching files", err)
+		}
+	}
+}
+
+// watches returns true if the file is watched
+func (w *fileWatcher) watches(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.files[filepath.Clean(name)]
+}
+
+// schedule calls onChange after the events settle
+func (w *fileWatcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(fileWatchDelay, w.onChange)
+}
+
+// Close stops watching the files
+func (w *fileWatcher) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestFileWatcher watches the paths and returns the channel which receives the changes
+func newTestFileWatcher(t *testing.T, paths ...string) (*fileWatcher, <-chan struct{}) {
+	t.Helper()
+	changed := make(chan struct{}, 1)
+	watcher, err := NewFileWatcher(paths, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("NewFileWatcher() error = %v", err)
+	}
+	t.Cleanup(func() {
+		watcher.Close()
+	})
+	return watcher.(*fileWatcher), changed
+}
+
+// waitChange waits for the change to be notified
+func waitChange(t *testing.T, changed <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change is not notified")
+	}
+}
+
+// watchState returns whether dir is watched and pending
+func (w *fileWatcher) watchState(dir string) (watched, pending bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dirs[dir], w.pending[dir]
+}
+
+func TestFileWatcher_change(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(file, []byte("defaults: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, changed := newTestFileWatcher(t, file)
+
+	if err := os.WriteFile(file, []byte("defaults: {model: gpt-4}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, changed)
+}
+
+func TestFileWatcher_SetFiles_missingDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "gochat", "prompts")
+	file := filepath.Join(dir, "summary.tmpl")
+	w, changed := newTestFileWatcher(t, file)
+
+	if watched, pending := w.watchState(dir); watched || !pending {
+		t.Errorf("missing dir watched = %v, pending = %v, want false, true", watched, pending)
+	}
+	if watched, _ := w.watchState(root); !watched {
+		t.Error("nearest existing parent is not watched")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("{{.Conversation}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, changed)
+	if watched, pending := w.watchState(dir); !watched || pending {
+		t.Errorf("created dir watched = %v, pending = %v, want true, false", watched, pending)
+	}
+}
+
+func TestFileWatcher_SetFiles_retry(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "gochat")
+	file := filepath.Join(dir, "config.yml")
+	w, _ := newTestFileWatcher(t)
+
+	if err := w.SetFiles([]string{file}); err != nil {
+		t.Fatalf("SetFiles() error = %v", err)
+	}
+	if watched, _ := w.watchState(dir); watched {
+		t.Fatal("missing dir is recorded as watched")
+	}
+
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetFiles([]string{file}); err != nil {
+		t.Fatalf("SetFiles() error = %v", err)
+	}
+	if watched, pending := w.watchState(dir); !watched || pending {
+		t.Errorf("dir watched = %v, pending = %v, want true, false", watched, pending)
+	}
+}
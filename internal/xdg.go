@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	appDirName = "gochat"
+)
+
+// xdgDir returns the application directory under the XDG base directory
+// env is the environment variable name, and fallback is the default path relative to the home directory
+func xdgDir(env string, fallback ...string) (string, error) {
+	base := os.Getenv(env)
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(append([]string{home}, fallback...)...)
+	}
+	return filepath.Join(base, appDirName), nil
+}
+
+// DefaultSessionDir returns the directory to store sessions
+func DefaultSessionDir() (string, error) {
+	dataDir, err := xdgDir("XDG_DATA_HOME", ".local", "share")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "sessions"), nil
+}
+
+// DefaultInputHistoryFile returns the file to store input history of the REPL
+func DefaultInputHistoryFile() (string, error) {
+	stateDir, err := xdgDir("XDG_STATE_HOME", ".local", "state")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "history"), nil
+}
+
+// DefaultConfigFile returns the user config file
+func DefaultConfigFile() (string, error) {
+	configDir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.yml"), nil
+}